@@ -85,6 +85,9 @@ type Conn struct {
 
 	wbuf []byte
 	eqb  ExtendedQueryBuilder
+
+	portalCount uint64
+	cursorCount uint64
 }
 
 // Identifier a PostgreSQL identifier or name. Identifiers can be composed of
@@ -356,6 +359,100 @@ func (c *Conn) Prepare(ctx context.Context, name, sql string) (sd *pgconn.Statem
 	return sd, nil
 }
 
+// PrepareAll prepares each of sqls as if by Prepare(ctx, sql, sql). The statements are prepared with a pipeline so the
+// server is only waited on once. If any statement fails to prepare the first error is returned and the statements
+// after it are not prepared.
+func (c *Conn) PrepareAll(ctx context.Context, sqls ...string) (err error) {
+	type pendingPrepare struct {
+		ctx    context.Context
+		sql    string
+		psName string
+	}
+
+	pending := make([]pendingPrepare, 0, len(sqls))
+	seen := make(map[string]struct{}, len(sqls))
+	for _, sql := range sqls {
+		if _, ok := seen[sql]; ok {
+			continue
+		}
+		seen[sql] = struct{}{}
+
+		traceCtx := ctx
+		if c.prepareTracer != nil {
+			traceCtx = c.prepareTracer.TracePrepareStart(ctx, c, TracePrepareStartData{Name: sql, SQL: sql})
+		}
+
+		if sd, ok := c.preparedStatements[sql]; ok && sd.SQL == sql {
+			if c.prepareTracer != nil {
+				c.prepareTracer.TracePrepareEnd(traceCtx, c, TracePrepareEndData{AlreadyPrepared: true})
+			}
+			continue
+		}
+
+		digest := sha256.Sum256([]byte(sql))
+		pending = append(pending, pendingPrepare{
+			ctx:    traceCtx,
+			sql:    sql,
+			psName: "stmt_" + hex.EncodeToString(digest[0:24]),
+		})
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if c.prepareTracer != nil {
+		defer func() {
+			for _, pp := range pending {
+				c.prepareTracer.TracePrepareEnd(pp.ctx, c, TracePrepareEndData{Err: err})
+			}
+		}()
+	}
+
+	pipeline := c.pgConn.StartPipeline(ctx)
+	defer func() {
+		closeErr := pipeline.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	for _, pp := range pending {
+		pipeline.SendPrepare(pp.psName, pp.sql, nil)
+	}
+
+	err = pipeline.Sync()
+	if err != nil {
+		return err
+	}
+
+	for _, pp := range pending {
+		results, err := pipeline.GetResults()
+		if err != nil {
+			return err
+		}
+
+		sd, ok := results.(*pgconn.StatementDescription)
+		if !ok {
+			return fmt.Errorf("expected statement description, got %T", results)
+		}
+		sd.Name = pp.psName
+		sd.SQL = pp.sql
+		c.preparedStatements[pp.sql] = sd
+	}
+
+	results, err := pipeline.GetResults()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := results.(*pgconn.PipelineSync); !ok {
+		return fmt.Errorf("expected sync, got %T", results)
+	}
+
+	return nil
+}
+
 // Deallocate releases a prepared statement. Calling Deallocate on a non-existent prepared statement will succeed.
 func (c *Conn) Deallocate(ctx context.Context, name string) error {
 	var psName string
@@ -702,6 +799,13 @@ type QueryResultFormats []int16
 // QueryResultFormatsByOID controls the result format (text=0, binary=1) of a query by the result column OID.
 type QueryResultFormatsByOID map[uint32]int16
 
+// QueryFetchSize causes a query to be executed in a named portal that is read QueryFetchSize rows at a time. The next
+// rows are fetched from the server when Rows.Next has consumed the previous ones. This allows reading very large
+// result sets with bounded memory without using DECLARE CURSOR. The query must be executed in a transaction and
+// QueryExecModeSimpleProtocol is not supported. A QueryFetchSize of 0 reads all rows at once. Rows.CommandTag counts
+// the rows of all fetches.
+type QueryFetchSize uint32
+
 // QueryRewriter rewrites a query when used as the first arguments to a query method.
 type QueryRewriter interface {
 	RewriteQuery(ctx context.Context, conn *Conn, sql string, args []any) (newSQL string, newArgs []any, err error)
@@ -725,9 +829,9 @@ type QueryRewriter interface {
 // An implementor of QueryRewriter may be passed as the first element of args. It can rewrite the sql and change or
 // replace args. For example, NamedArgs is QueryRewriter that implements named arguments.
 //
-// For extra control over how the query is executed, the types QueryExecMode, QueryResultFormats, and
-// QueryResultFormatsByOID may be used as the first args to control exactly how the query is executed. This is rarely
-// needed. See the documentation for those types for details.
+// For extra control over how the query is executed, the types QueryExecMode, QueryResultFormats,
+// QueryResultFormatsByOID, and QueryFetchSize may be used as the first args to control exactly how the query is
+// executed. This is rarely needed. See the documentation for those types for details.
 func (c *Conn) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
 	if c.queryTracer != nil {
 		ctx = c.queryTracer.TraceQueryStart(ctx, c, TraceQueryStartData{SQL: sql, Args: args})
@@ -744,6 +848,7 @@ func (c *Conn) Query(ctx context.Context, sql string, args ...any) (Rows, error)
 	var resultFormatsByOID QueryResultFormatsByOID
 	mode := c.config.DefaultQueryExecMode
 	var queryRewriter QueryRewriter
+	var fetchSize QueryFetchSize
 
 optionLoop:
 	for len(args) > 0 {
@@ -757,6 +862,9 @@ optionLoop:
 		case QueryExecMode:
 			mode = arg
 			args = args[1:]
+		case QueryFetchSize:
+			fetchSize = arg
+			args = args[1:]
 		case QueryRewriter:
 			queryRewriter = arg
 			args = args[1:]
@@ -786,6 +894,20 @@ optionLoop:
 	c.eqb.reset()
 	rows := c.getRows(ctx, sql, args)
 
+	if fetchSize > 0 {
+		if mode == QueryExecModeSimpleProtocol {
+			rows.fatal(errors.New("QueryFetchSize is not supported with QueryExecModeSimpleProtocol"))
+			return rows, rows.err
+		}
+		if c.pgConn.TxStatus() != 'T' {
+			rows.fatal(errors.New("QueryFetchSize requires a transaction"))
+			return rows, rows.err
+		}
+		c.portalCount++
+		rows.portalName = fmt.Sprintf("pgx_portal_%d", c.portalCount)
+		rows.fetchSize = uint32(fetchSize)
+	}
+
 	var err error
 	sd, explicitPreparedStatement := c.preparedStatements[sql]
 	if sd != nil || mode == QueryExecModeCacheStatement || mode == QueryExecModeCacheDescribe || mode == QueryExecModeDescribeExec {
@@ -822,9 +944,9 @@ optionLoop:
 		}
 
 		if !explicitPreparedStatement && mode == QueryExecModeCacheDescribe {
-			rows.resultReader = c.pgConn.ExecParams(ctx, sql, c.eqb.ParamValues, sd.ParamOIDs, c.eqb.ParamFormats, resultFormats)
+			rows.resultReader = c.queryParams(ctx, rows, sql, sd.ParamOIDs, resultFormats)
 		} else {
-			rows.resultReader = c.pgConn.ExecPrepared(ctx, sd.Name, c.eqb.ParamValues, c.eqb.ParamFormats, resultFormats)
+			rows.resultReader = c.queryPrepared(ctx, rows, sd.Name, resultFormats)
 		}
 	} else if mode == QueryExecModeExec {
 		err := c.eqb.Build(c.typeMap, nil, args)
@@ -833,7 +955,7 @@ optionLoop:
 			return rows, rows.err
 		}
 
-		rows.resultReader = c.pgConn.ExecParams(ctx, sql, c.eqb.ParamValues, nil, c.eqb.ParamFormats, c.eqb.ResultFormats)
+		rows.resultReader = c.queryParams(ctx, rows, sql, nil, c.eqb.ResultFormats)
 	} else if mode == QueryExecModeSimpleProtocol {
 		sql, err = c.sanitizeForSimpleQuery(sql, args...)
 		if err != nil {
@@ -863,6 +985,23 @@ optionLoop:
 	return rows, rows.err
 }
 
+// queryParams executes sql with the parameters in c.eqb for rows. It uses a portal if rows has a fetch size.
+func (c *Conn) queryParams(ctx context.Context, rows *baseRows, sql string, paramOIDs []uint32, resultFormats []int16) *pgconn.ResultReader {
+	if rows.portalName != "" {
+		return c.pgConn.ExecParamsPortal(ctx, rows.portalName, sql, c.eqb.ParamValues, paramOIDs, c.eqb.ParamFormats, resultFormats, rows.fetchSize)
+	}
+	return c.pgConn.ExecParams(ctx, sql, c.eqb.ParamValues, paramOIDs, c.eqb.ParamFormats, resultFormats)
+}
+
+// queryPrepared executes the prepared statement stmtName with the parameters in c.eqb for rows. It uses a portal if
+// rows has a fetch size.
+func (c *Conn) queryPrepared(ctx context.Context, rows *baseRows, stmtName string, resultFormats []int16) *pgconn.ResultReader {
+	if rows.portalName != "" {
+		return c.pgConn.ExecPreparedPortal(ctx, rows.portalName, stmtName, c.eqb.ParamValues, c.eqb.ParamFormats, resultFormats, rows.fetchSize)
+	}
+	return c.pgConn.ExecPrepared(ctx, stmtName, c.eqb.ParamValues, c.eqb.ParamFormats, resultFormats)
+}
+
 // getStatementDescription returns the statement description of the sql query
 // according to the given mode.
 //
@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +54,20 @@ func TestStmtCacheSizeLimit(t *testing.T) {
 	assert.Len(t, conn.preparedStatements, cacheLimit+1)
 	assert.Equal(t, cacheLimit, conn.statementCache.Len())
 }
+
+func TestAddCommandTagRows(t *testing.T) {
+	for _, tt := range []struct {
+		commandTag string
+		n          int64
+		expected   string
+	}{
+		{"SELECT 100", 9900, "SELECT 10000"},
+		{"SELECT 0", 300, "SELECT 300"},
+		{"INSERT 0 2", 3, "INSERT 0 5"},
+		{"", 3, ""},
+		{"CREATE TABLE", 3, "CREATE TABLE"},
+	} {
+		commandTag := addCommandTagRows(pgconn.NewCommandTag(tt.commandTag), tt.n)
+		assert.Equal(t, tt.expected, commandTag.String(), tt.commandTag)
+	}
+}
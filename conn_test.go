@@ -480,6 +480,35 @@ func TestPrepareBadSQLFailure(t *testing.T) {
 	ensureConnValid(t, conn)
 }
 
+func TestPrepareAll(t *testing.T) {
+	t.Parallel()
+
+	conn := mustConnectString(t, os.Getenv("PGX_TEST_DATABASE"))
+	defer closeConn(t, conn)
+
+	err := conn.PrepareAll(context.Background(), "select $1::varchar", "select $1::integer", "select $1::varchar")
+	require.NoError(t, err)
+
+	var count int
+	err = conn.QueryRow(context.Background(), "select count(*) from pg_prepared_statements where statement in ('select $1::varchar', 'select $1::integer')", pgx.QueryExecModeSimpleProtocol).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	var s string
+	err = conn.QueryRow(context.Background(), "select $1::varchar", "hello").Scan(&s)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", s)
+
+	// Statements that are already prepared are skipped.
+	err = conn.PrepareAll(context.Background(), "select $1::varchar", "select $1::text")
+	require.NoError(t, err)
+
+	err = conn.PrepareAll(context.Background(), "select $1::text", "select foo")
+	require.Error(t, err)
+
+	ensureConnValid(t, conn)
+}
+
 func TestPrepareIdempotency(t *testing.T) {
 	t.Parallel()
 
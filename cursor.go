@@ -0,0 +1,314 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultCursorFetchSize is the number of rows fetched at a time when CursorOptions.FetchSize is 0.
+const DefaultCursorFetchSize = 100
+
+// CursorOptions controls how a cursor is declared by DeclareCursor.
+type CursorOptions struct {
+	// Name is the name of the cursor. If it is empty a unique name is generated.
+	Name string
+
+	// FetchSize is the number of rows fetched from the server at a time. If it is 0 DefaultCursorFetchSize is used.
+	FetchSize int
+
+	// Scroll declares the cursor with SCROLL. This is required to move the cursor backward.
+	Scroll bool
+
+	// WithHold declares the cursor WITH HOLD. This allows the cursor to be used after the transaction that declared it
+	// is committed. A cursor declared WITH HOLD should be explicitly closed as it is otherwise kept open until the end of
+	// the session.
+	WithHold bool
+}
+
+// Cursor is a server-side cursor declared with DeclareCursor. It is only valid within the transaction where it was
+// declared unless it was declared with CursorOptions.WithHold. Cursor is not safe for concurrent usage.
+//
+// For more details see: https://www.postgresql.org/docs/current/sql-declare.html
+type Cursor struct {
+	conn       *Conn
+	name       string
+	fetchSQL   string
+	fetchSize  int64
+	scroll     bool
+	atEnd      bool
+	closed     bool
+	activeRows *cursorRows
+}
+
+// DeclareCursor declares a server-side cursor for the query sql with args in tx. args may include the query options
+// accepted by Exec such as a QueryRewriter.
+//
+// The returned Cursor must be closed with Close.
+func DeclareCursor(ctx context.Context, tx Tx, sql string, options CursorOptions, args ...any) (*Cursor, error) {
+	conn := tx.Conn()
+
+	name := options.Name
+	if name == "" {
+		conn.cursorCount++
+		name = "pgx_cursor_" + strconv.FormatUint(conn.cursorCount, 10)
+	}
+	quotedName := Identifier{name}.Sanitize()
+
+	fetchSize := options.FetchSize
+	if fetchSize == 0 {
+		fetchSize = DefaultCursorFetchSize
+	}
+	if fetchSize < 0 {
+		return nil, errors.New("cursor fetch size must not be negative")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("declare ")
+	sb.WriteString(quotedName)
+	if options.Scroll {
+		sb.WriteString(" scroll")
+	}
+	sb.WriteString(" cursor")
+	if options.WithHold {
+		sb.WriteString(" with hold")
+	}
+	sb.WriteString(" for ")
+	sb.WriteString(sql)
+
+	// Each cursor has a distinct declare statement. Do not pollute the statement caches with them.
+	mode := conn.config.DefaultQueryExecMode
+	if mode == QueryExecModeCacheStatement || mode == QueryExecModeCacheDescribe {
+		args = append([]any{QueryExecModeDescribeExec}, args...)
+	}
+	_, err := tx.Exec(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &Cursor{
+		conn:      conn,
+		name:      quotedName,
+		fetchSQL:  fmt.Sprintf("fetch forward %d from %s", fetchSize, quotedName),
+		fetchSize: int64(fetchSize),
+		scroll:    options.Scroll,
+	}
+
+	return cursor, nil
+}
+
+// Rows returns a Rows that reads the rows of the cursor from the current position to the end. Rows are fetched from
+// the server CursorOptions.FetchSize rows at a time. Like any Rows, it must be closed before the connection is used
+// again. Closing the Rows does not close the cursor. Afterwards the cursor is positioned on the last row read. With a
+// cursor that was not declared with CursorOptions.Scroll, rows that were fetched but not read when the Rows is closed
+// are skipped.
+func (c *Cursor) Rows(ctx context.Context) Rows {
+	rows := &cursorRows{cursor: c, ctx: ctx}
+	if c.closed {
+		rows.err = errors.New("cursor is closed")
+		rows.closed = true
+		return rows
+	}
+	c.activeRows = rows
+	return rows
+}
+
+// Move moves the cursor count rows. count may be negative to move backward, which requires CursorOptions.Scroll. It
+// returns the number of rows moved over.
+func (c *Cursor) Move(ctx context.Context, count int64) (int64, error) {
+	commandTag, err := c.move(ctx, "move relative "+strconv.FormatInt(count, 10)+" from "+c.name)
+	if err != nil {
+		return 0, err
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// MoveAbsolute positions the cursor on row position. Rows are numbered from 1. 0 positions the cursor before the first
+// row and negative positions count from the end. The next row read with Rows is the row after position. Moving to an
+// earlier row requires CursorOptions.Scroll.
+func (c *Cursor) MoveAbsolute(ctx context.Context, position int64) error {
+	_, err := c.move(ctx, "move absolute "+strconv.FormatInt(position, 10)+" from "+c.name)
+	return err
+}
+
+func (c *Cursor) move(ctx context.Context, sql string) (pgconn.CommandTag, error) {
+	if c.closed {
+		return pgconn.CommandTag{}, errors.New("cursor is closed")
+	}
+	if c.activeRows != nil && !c.activeRows.closed {
+		return pgconn.CommandTag{}, errors.New("cursor rows must be closed before moving the cursor")
+	}
+
+	commandTag, err := c.conn.Exec(ctx, sql)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	c.atEnd = false
+	return commandTag, nil
+}
+
+// Close closes the cursor. Any open Rows from the cursor are closed first. It is safe to call Close on an already
+// closed cursor.
+func (c *Cursor) Close(ctx context.Context) error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.activeRows != nil {
+		c.activeRows.Close()
+	}
+
+	// The fetch statement is no longer used. Remove it from the statement caches instead of waiting for it to be evicted.
+	if sc := c.conn.statementCache; sc != nil {
+		sc.Invalidate(c.fetchSQL)
+	}
+	if sc := c.conn.descriptionCache; sc != nil {
+		sc.Invalidate(c.fetchSQL)
+	}
+
+	_, err := c.conn.Exec(ctx, "close "+c.name)
+	return err
+}
+
+// cursorRows implements the Rows interface for Cursor.Rows.
+type cursorRows struct {
+	cursor *Cursor
+	ctx    context.Context
+
+	// batch is the result of the current fetch. batchRead is the number of rows read from it.
+	batch     Rows
+	batchRead int64
+
+	rowCount int64
+	err      error
+	closed   bool
+}
+
+func (rows *cursorRows) Close() {
+	if rows.closed {
+		return
+	}
+	rows.closed = true
+
+	if rows.batch != nil {
+		rows.endBatch(true)
+	}
+}
+
+// endBatch closes the current batch. If restorePosition is true and not all fetched rows were read, a scroll cursor
+// is moved back to the last row read.
+func (rows *cursorRows) endBatch(restorePosition bool) {
+	batch := rows.batch
+	rows.batch = nil
+
+	batch.Close()
+	if err := batch.Err(); err != nil {
+		if rows.err == nil {
+			rows.err = err
+		}
+		return
+	}
+
+	fetched := batch.CommandTag().RowsAffected()
+	if fetched < rows.cursor.fetchSize {
+		rows.cursor.atEnd = true
+	}
+
+	if restorePosition && rows.batchRead < fetched && rows.cursor.scroll {
+		// When the fetch reached the end the cursor is positioned after the last row.
+		unread := fetched - rows.batchRead
+		if rows.cursor.atEnd {
+			unread++
+		}
+		_, err := rows.cursor.conn.Exec(rows.ctx, "move backward "+strconv.FormatInt(unread, 10)+" from "+rows.cursor.name)
+		if err != nil && rows.err == nil {
+			rows.err = err
+		}
+		rows.cursor.atEnd = false
+	}
+}
+
+func (rows *cursorRows) Err() error {
+	return rows.err
+}
+
+func (rows *cursorRows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag("FETCH " + strconv.FormatInt(rows.rowCount, 10))
+}
+
+func (rows *cursorRows) FieldDescriptions() []pgconn.FieldDescription {
+	if rows.batch == nil {
+		return nil
+	}
+	return rows.batch.FieldDescriptions()
+}
+
+func (rows *cursorRows) Next() bool {
+	for !rows.closed {
+		if rows.batch == nil {
+			if rows.cursor.atEnd {
+				rows.Close()
+				return false
+			}
+
+			// The fetch statement is executed with the default query exec mode. With a statement cache it is prepared once
+			// and evicted like any other cached statement if the cursor is never closed.
+			batch, err := rows.cursor.conn.Query(rows.ctx, rows.cursor.fetchSQL)
+			if err != nil {
+				rows.err = err
+				rows.Close()
+				return false
+			}
+			rows.batch = batch
+			rows.batchRead = 0
+		}
+
+		if rows.batch.Next() {
+			rows.batchRead++
+			rows.rowCount++
+			return true
+		}
+
+		rows.endBatch(false)
+		if rows.err != nil {
+			rows.Close()
+			return false
+		}
+	}
+
+	return false
+}
+
+func (rows *cursorRows) Scan(dest ...any) error {
+	if rows.batch == nil {
+		return errors.New("no current row")
+	}
+	err := rows.batch.Scan(dest...)
+	if err != nil && rows.err == nil {
+		rows.err = err
+	}
+	return err
+}
+
+func (rows *cursorRows) Values() ([]any, error) {
+	if rows.batch == nil {
+		return nil, errors.New("no current row")
+	}
+	return rows.batch.Values()
+}
+
+func (rows *cursorRows) RawValues() [][]byte {
+	if rows.batch == nil {
+		return nil
+	}
+	return rows.batch.RawValues()
+}
+
+func (rows *cursorRows) Conn() *Conn {
+	return rows.cursor.conn
+}
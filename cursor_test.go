@@ -0,0 +1,143 @@
+package pgx_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorCollectRows(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	pgxtest.RunWithQueryExecModes(ctx, t, defaultConnTestRunner, nil, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		cursor, err := pgx.DeclareCursor(ctx, tx, "select n, 'n' || n as s from generate_series(1, $1) n", pgx.CursorOptions{FetchSize: 3}, 10)
+		require.NoError(t, err)
+		defer cursor.Close(ctx)
+
+		type row struct {
+			N int32
+			S string
+		}
+		result, err := pgx.CollectRows(cursor.Rows(ctx), pgx.RowToStructByName[row])
+		require.NoError(t, err)
+		require.Len(t, result, 10)
+		for i, r := range result {
+			require.Equal(t, int32(i+1), r.N)
+			require.Equal(t, fmt.Sprintf("n%d", i+1), r.S)
+		}
+
+		// All rows have been read.
+		rows := cursor.Rows(ctx)
+		require.False(t, rows.Next())
+		require.NoError(t, rows.Err())
+
+		require.NoError(t, cursor.Close(ctx))
+
+		// The fetch statement is not left prepared on the connection.
+		if conn.PgConn().ParameterStatus("crdb_version") == "" {
+			var preparedFetches int
+			err = tx.QueryRow(ctx, "select count(*) from pg_prepared_statements where statement like 'fetch%'").Scan(&preparedFetches)
+			require.NoError(t, err)
+			require.Zero(t, preparedFetches)
+		}
+
+		ensureConnValid(t, conn)
+	})
+}
+
+func TestCursorScroll(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	pgxtest.RunWithQueryExecModes(ctx, t, defaultConnTestRunner, nil, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		pgxtest.SkipCockroachDB(t, conn, "Server does not support scroll cursors")
+
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		cursor, err := pgx.DeclareCursor(ctx, tx, "select generate_series(1, 10)", pgx.CursorOptions{FetchSize: 4, Scroll: true})
+		require.NoError(t, err)
+		defer cursor.Close(ctx)
+
+		readN := func(n int) []int32 {
+			rows := cursor.Rows(ctx)
+			defer rows.Close()
+			var values []int32
+			for len(values) < n && rows.Next() {
+				var v int32
+				require.NoError(t, rows.Scan(&v))
+				values = append(values, v)
+			}
+			rows.Close()
+			require.NoError(t, rows.Err())
+			return values
+		}
+
+		// Closing rows early leaves the cursor on the last row read.
+		require.Equal(t, []int32{1, 2}, readN(2))
+		require.Equal(t, []int32{3, 4, 5}, readN(3))
+
+		require.NoError(t, cursor.MoveAbsolute(ctx, 7))
+		require.Equal(t, []int32{8, 9, 10}, readN(100))
+
+		require.NoError(t, cursor.MoveAbsolute(ctx, 0))
+		require.Equal(t, []int32{1}, readN(1))
+
+		moved, err := cursor.Move(ctx, 3)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, moved)
+		require.Equal(t, []int32{5, 6}, readN(2))
+
+		_, err = cursor.Move(ctx, -4)
+		require.NoError(t, err)
+		require.Equal(t, []int32{3}, readN(1))
+
+		// Reading to the end and closing early at the end.
+		require.NoError(t, cursor.MoveAbsolute(ctx, 5))
+		require.Equal(t, []int32{6, 7, 8, 9}, readN(4))
+		require.Equal(t, []int32{10}, readN(1))
+		require.Empty(t, readN(1))
+
+		require.NoError(t, cursor.Close(ctx))
+		ensureConnValid(t, conn)
+	})
+}
+
+func TestCursorWithHold(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	pgxtest.RunWithQueryExecModes(ctx, t, defaultConnTestRunner, nil, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+
+		cursor, err := pgx.DeclareCursor(ctx, tx, "select generate_series(1, 5)", pgx.CursorOptions{Name: "held cursor", FetchSize: 2, WithHold: true})
+		require.NoError(t, err)
+
+		require.NoError(t, tx.Commit(ctx))
+
+		values, err := pgx.CollectRows(cursor.Rows(ctx), pgx.RowTo[int32])
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3, 4, 5}, values)
+
+		require.NoError(t, cursor.Close(ctx))
+		ensureConnValid(t, conn)
+	})
+}
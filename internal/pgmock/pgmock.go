@@ -4,7 +4,9 @@ package pgmock
 import (
 	"fmt"
 	"io"
+	"net"
 	"reflect"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgproto3"
 )
@@ -130,7 +132,146 @@ func AcceptUnauthenticatedConnRequestSteps() []Step {
 	return []Step{
 		ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
 		SendMessage(&pgproto3.AuthenticationOk{}),
-		SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: 0}),
+		SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}),
 		SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
 	}
 }
+
+type standbyQueriesStep struct {
+	replayLSN string
+	lag       string
+}
+
+func (e *standbyQueriesStep) Step(backend *pgproto3.Backend) error {
+	for {
+		msg, err := backend.Receive()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch msg.(type) {
+		case *pgproto3.Query:
+			backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+				{Name: []byte("pg_last_wal_replay_lsn"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1},
+				{Name: []byte("case"), DataTypeOID: 701, DataTypeSize: 8, TypeModifier: -1},
+			}})
+			backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(e.replayLSN), []byte(e.lag)}})
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			err = backend.Flush()
+			if err != nil {
+				return err
+			}
+		case *pgproto3.Terminate:
+			return nil
+		default:
+			return fmt.Errorf("unexpected message %#v", msg)
+		}
+	}
+}
+
+// StartStandby starts a mock standby on a random local port that accepts any number of connections. Every simple
+// protocol query is answered with the row (replayLSN, lag) of the replication lag query used by pgxpool and
+// pgxreplica. lag is in seconds. The standby stops accepting connections when the returned listener is closed.
+func StartStandby(replayLSN, lag string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			// The simple protocol in pgx requires standard_conforming_strings and client_encoding.
+			steps := AcceptUnauthenticatedConnRequestSteps()
+			script := &Script{Steps: append(steps[:len(steps)-1],
+				SendMessage(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"}),
+				SendMessage(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"}),
+				steps[len(steps)-1],
+				&standbyQueriesStep{replayLSN: replayLSN, lag: lag},
+			)}
+
+			go func() {
+				defer conn.Close()
+				script.Run(pgproto3.NewBackend(conn, conn))
+			}()
+		}
+	}()
+
+	return ln, nil
+}
+
+// Serve starts a mock server on a random local port that runs each script against a successively accepted connection.
+// Each connection must be done within 5 seconds. The returned channel receives the first error and is closed when the
+// last script has run or when the returned listener is closed.
+func Serve(scripts ...*Script) (net.Listener, chan error, error) {
+	return serve(false, scripts)
+}
+
+// ServeIgnoringCancelRequests is like Serve except that connections sending a CancelRequest are closed without running
+// a script. As the server receives the startup message of each connection, the scripts must not expect it.
+func ServeIgnoringCancelRequests(scripts ...*Script) (net.Listener, chan error, error) {
+	return serve(true, scripts)
+}
+
+func serve(ignoreCancelRequests bool, scripts []*Script) (net.Listener, chan error, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		defer close(serverErrChan)
+
+		for len(scripts) > 0 {
+			ran, err := serveConn(ln, scripts[0], ignoreCancelRequests)
+			if err != nil {
+				serverErrChan <- err
+				return
+			}
+			if ran {
+				scripts = scripts[1:]
+			}
+		}
+	}()
+
+	return ln, serverErrChan, nil
+}
+
+// serveConn accepts a connection and runs script. It returns false if the connection was an ignored cancel request.
+func serveConn(ln net.Listener, script *Script, ignoreCancelRequests bool) (bool, error) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return false, err
+	}
+
+	backend := pgproto3.NewBackend(conn, conn)
+	if ignoreCancelRequests {
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return false, err
+		}
+		switch msg.(type) {
+		case *pgproto3.StartupMessage:
+		case *pgproto3.CancelRequest:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected startup message %T", msg)
+		}
+	}
+
+	return true, script.Run(backend)
+}
@@ -3,6 +3,7 @@ package pgmock_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"testing"
@@ -41,34 +42,10 @@ func TestScript(t *testing.T) {
 	script.Steps = append(script.Steps, pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}))
 	script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
 
-	ln, err := net.Listen("tcp", "127.0.0.1:")
+	ln, serverErrChan, err := pgmock.Serve(script)
 	require.NoError(t, err)
 	defer ln.Close()
 
-	serverErrChan := make(chan error, 1)
-	go func() {
-		defer close(serverErrChan)
-
-		conn, err := ln.Accept()
-		if err != nil {
-			serverErrChan <- err
-			return
-		}
-		defer conn.Close()
-
-		err = conn.SetDeadline(time.Now().Add(time.Second))
-		if err != nil {
-			serverErrChan <- err
-			return
-		}
-
-		err = script.Run(pgproto3.NewBackend(conn, conn))
-		if err != nil {
-			serverErrChan <- err
-			return
-		}
-	}()
-
 	host, port, _ := strings.Cut(ln.Addr().String(), ":")
 	connStr := fmt.Sprintf("sslmode=disable host=%s port=%s", host, port)
 
@@ -89,3 +66,63 @@ func TestScript(t *testing.T) {
 
 	assert.NoError(t, <-serverErrChan)
 }
+
+func TestStartStandby(t *testing.T) {
+	ln, err := pgmock.StartStandby("0/3000148", "12.5")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	connStr := fmt.Sprintf("sslmode=disable host=%s port=%s", host, port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Each connection answers any number of queries.
+	for i := 0; i < 2; i++ {
+		pgConn, err := pgconn.Connect(ctx, connStr)
+		require.NoError(t, err)
+
+		for j := 0; j < 2; j++ {
+			results, err := pgConn.Exec(ctx, "select pg_last_wal_replay_lsn()").ReadAll()
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Len(t, results[0].Rows, 1)
+			assert.Equal(t, [][]byte{[]byte("0/3000148"), []byte("12.5")}, results[0].Rows[0])
+		}
+
+		require.NoError(t, pgConn.Close(ctx))
+	}
+}
+
+func TestServeIgnoringCancelRequests(t *testing.T) {
+	// The server receives the startup message.
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()[1:]}
+	script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+
+	ln, serverErrChan, err := pgmock.ServeIgnoringCancelRequests(script)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// The cancel request is closed without using up the script.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	buf, err := (&pgproto3.CancelRequest{ProcessID: 1, SecretKey: []byte{0, 0, 0, 0}}).Encode(nil)
+	require.NoError(t, err)
+	_, err = conn.Write(buf)
+	require.NoError(t, err)
+	_, err = conn.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+	conn.Close()
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	connStr := fmt.Sprintf("sslmode=disable host=%s port=%s", host, port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pgConn, err := pgconn.Connect(ctx, connStr)
+	require.NoError(t, err)
+	require.NoError(t, pgConn.Close(ctx))
+
+	assert.NoError(t, <-serverErrChan)
+}
@@ -2,10 +2,10 @@ package pgx
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
-
-	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // The PostgreSQL wire protocol has a limit of 1 GB - 1 per message. See definition of
@@ -13,6 +13,12 @@ import (
 // in the message,maxLargeObjectMessageLength should be no larger than 1 GB - 1 KB.
 var maxLargeObjectMessageLength = 1024*1024*1024 - 1024
 
+// OIDs of the built-in large object functions called with the fast-path function call protocol.
+const (
+	loreadOID  = 954
+	lowriteOID = 955
+)
+
 // LargeObjects is a structure used to access the large objects API. It is only valid within the transaction where it
 // was created.
 //
@@ -84,11 +90,18 @@ func (o *LargeObject) Write(p []byte) (int, error) {
 			expected = maxLargeObjectMessageLength
 		}
 
-		var n int
-		err := o.tx.QueryRow(o.ctx, "select lowrite($1, $2)", o.fd, p[nTotal:nTotal+expected]).Scan(&n)
+		result, err := o.tx.Conn().PgConn().FunctionCall(o.ctx, lowriteOID,
+			[][]byte{binary.BigEndian.AppendUint32(nil, uint32(o.fd)), p[nTotal : nTotal+expected]},
+			[]int16{BinaryFormatCode},
+			BinaryFormatCode,
+		)
 		if err != nil {
 			return nTotal, err
 		}
+		if len(result) != 4 {
+			return nTotal, errors.New("invalid lowrite result")
+		}
+		n := int(int32(binary.BigEndian.Uint32(result)))
 
 		if n < 0 {
 			return nTotal, errors.New("failed to write to large object")
@@ -117,19 +130,23 @@ func (o *LargeObject) Read(p []byte) (int, error) {
 			expected = maxLargeObjectMessageLength
 		}
 
-		res := pgtype.PreallocBytes(p[nTotal:])
-		err := o.tx.QueryRow(o.ctx, "select loread($1, $2)", o.fd, expected).Scan(&res)
-		// We compute expected so that it always fits into p, so it should never happen
-		// that PreallocBytes's ScanBytes had to allocate a new slice.
-		nTotal += len(res)
+		// The result is read directly into p. Limiting the capacity ensures a longer result does not overwrite p.
+		res, err := o.tx.Conn().PgConn().FunctionCallInto(o.ctx, loreadOID,
+			[][]byte{binary.BigEndian.AppendUint32(nil, uint32(o.fd)), binary.BigEndian.AppendUint32(nil, uint32(expected))},
+			[]int16{BinaryFormatCode},
+			BinaryFormatCode,
+			p[nTotal:nTotal:nTotal+expected],
+		)
 		if err != nil {
 			return nTotal, err
 		}
+		if len(res) > expected {
+			return nTotal, fmt.Errorf("lo_read returned %d bytes, expected at most %d", len(res), expected)
+		}
 
+		nTotal += len(res)
 		if len(res) < expected {
 			return nTotal, io.EOF
-		} else if len(res) > expected {
-			return nTotal, errors.New("invalid read of large object")
 		}
 	}
 
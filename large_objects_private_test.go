@@ -1,7 +1,16 @@
 package pgx
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
 )
 
 // SetMaxLargeObjectMessageLength sets internal maxLargeObjectMessageLength variable
@@ -18,3 +27,62 @@ func SetMaxLargeObjectMessageLength(t *testing.T, length int) {
 
 	maxLargeObjectMessageLength = length
 }
+
+func TestLargeObjectReadRejectsLongResult(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	script.Steps = append(script.Steps,
+		pgmock.ExpectMessage(&pgproto3.Query{String: "begin"}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+		pgmock.ExpectAnyMessage(&pgproto3.FunctionCall{}),
+		pgmock.SendMessage(&pgproto3.FunctionCallResponse{Result: []byte("hello")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+		pgmock.ExpectMessage(&pgproto3.Terminate{}),
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		defer close(serverErrChan)
+
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+		defer conn.Close()
+
+		err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+
+		serverErrChan <- script.Run(pgproto3.NewBackend(conn, conn))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	conn, err := Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+
+	lo := &LargeObject{ctx: ctx, tx: tx, fd: 0}
+	buf := make([]byte, 8)
+	n, err := lo.Read(buf[:4])
+	require.EqualError(t, err, "lo_read returned 5 bytes, expected at most 4")
+	require.Equal(t, 0, n)
+	require.Equal(t, make([]byte, 8), buf, "a long result must not be written past the end of p")
+
+	require.NoError(t, conn.Close(ctx))
+	require.NoError(t, <-serverErrChan)
+}
@@ -0,0 +1,229 @@
+package pgconn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// SASLAuthInfo describes the connection being authenticated by a SASLMechanism.
+type SASLAuthInfo struct {
+	Config *Config
+
+	// Conn is the underlying connection. It is a *tls.Conn when the connection uses TLS.
+	Conn net.Conn
+
+	// Host is the host being connected to.
+	Host string
+
+	// Password is the password for the connection. It is returned by Config.GetPassword if it is set, otherwise by the
+	// password provider registered with RegisterPasswordProvider if there is one, otherwise it is Config.Password.
+	Password string
+
+	// ServerMechanisms are the SASL mechanisms offered by the server in order of preference.
+	ServerMechanisms []string
+}
+
+// SASLMechanism performs the client side of one SASL authentication exchange.
+type SASLMechanism interface {
+	// Start returns the name of the mechanism to use and the data of the SASLInitialResponse message. The name may
+	// differ from the name the mechanism was registered with (e.g. SCRAM-SHA-256-PLUS instead of SCRAM-SHA-256).
+	Start() (mechanism string, initialResponse []byte, err error)
+
+	// Continue is called with the data of each AuthenticationSASLContinue message. It returns the data of the
+	// SASLResponse message to send.
+	Continue(data []byte) (response []byte, err error)
+
+	// Final is called with the data of the AuthenticationSASLFinal message. It is called with nil data if the server
+	// completes authentication without sending AuthenticationSASLFinal. Returning an error fails the authentication.
+	Final(data []byte) error
+}
+
+// SASLChannelBinder is implemented by a SASLMechanism that can bind the authentication to the TLS connection. It is
+// used to enforce Config.ChannelBinding "require".
+type SASLChannelBinder interface {
+	// ChannelBound returns true if the completed exchange used channel binding.
+	ChannelBound() bool
+}
+
+// NewSASLMechanismFunc creates a SASLMechanism for a connection attempt, for use with RegisterSASLMechanism.
+type NewSASLMechanismFunc func(ctx context.Context, info *SASLAuthInfo) (SASLMechanism, error)
+
+var (
+	authRegistryMux  sync.RWMutex
+	saslMechanisms   = map[string]NewSASLMechanismFunc{scramSHA256Name: newScramMechanism}
+	passwordProvider GetPasswordFunc
+)
+
+// RegisterSASLMechanism registers a SASL authentication mechanism with name. When the server requests SASL
+// authentication the first mechanism it offers that is registered is used. SCRAM-SHA-256 is registered by default.
+// Registering a mechanism with a name that is already registered replaces it. Registering nil removes it. For example,
+// to add a custom mechanism:
+//
+//	func init() {
+//		pgconn.RegisterSASLMechanism("X-CUSTOM", func(ctx context.Context, info *pgconn.SASLAuthInfo) (pgconn.SASLMechanism, error) {
+//			return newCustomMechanism(info.Config.User, info.Password), nil
+//		})
+//	}
+func RegisterSASLMechanism(name string, newMechanism NewSASLMechanismFunc) {
+	authRegistryMux.Lock()
+	defer authRegistryMux.Unlock()
+
+	if newMechanism == nil {
+		delete(saslMechanisms, name)
+		return
+	}
+	saslMechanisms[name] = newMechanism
+}
+
+// RegisterPasswordProvider registers a process-wide provider of the password used for cleartext, MD5, and SASL
+// authentication. It is called the same way as Config.GetPassword and is used instead of Config.Password for every
+// connection whose Config.GetPassword is nil. Config.GetPassword always takes precedence because it is set for a
+// specific connection configuration, while the registered provider is a default for connections whose Config the
+// application does not build itself, such as those opened by libraries or through database/sql with a connection
+// string. Registering nil restores the default of using Config.Password.
+func RegisterPasswordProvider(provider GetPasswordFunc) {
+	authRegistryMux.Lock()
+	defer authRegistryMux.Unlock()
+
+	passwordProvider = provider
+}
+
+// lookupSASLMechanism returns the first mechanism in serverMechanisms that is registered.
+func lookupSASLMechanism(serverMechanisms []string) NewSASLMechanismFunc {
+	authRegistryMux.RLock()
+	defer authRegistryMux.RUnlock()
+
+	for _, name := range serverMechanisms {
+		if newMechanism, ok := saslMechanisms[name]; ok {
+			return newMechanism
+		}
+	}
+	return nil
+}
+
+// authPassword returns the password to authenticate to the host of connectConfig.
+func (c *PgConn) authPassword(ctx context.Context, connectConfig *connectOneConfig) (string, error) {
+	if c.config.GetPassword != nil {
+		password, err := c.config.GetPassword(ctx, connectConfig.originalHostname, connectConfig.port, c.config.User)
+		if err != nil {
+			return "", fmt.Errorf("GetPassword failed: %w", err)
+		}
+		return password, nil
+	}
+
+	authRegistryMux.RLock()
+	provider := passwordProvider
+	authRegistryMux.RUnlock()
+
+	if provider == nil {
+		return c.config.Password, nil
+	}
+
+	password, err := provider(ctx, connectConfig.originalHostname, connectConfig.port, c.config.User)
+	if err != nil {
+		return "", fmt.Errorf("password provider failed: %w", err)
+	}
+	return password, nil
+}
+
+// Perform SASL authentication with the first registered mechanism offered by the server.
+func (c *PgConn) saslAuth(ctx context.Context, connectConfig *connectOneConfig, serverAuthMechanisms []string) error {
+	newMechanism := lookupSASLMechanism(serverAuthMechanisms)
+	if newMechanism == nil {
+		return fmt.Errorf("server does not support any registered SASL mechanism (server offered %s)", strings.Join(serverAuthMechanisms, ", "))
+	}
+
+	password, err := c.authPassword(ctx, connectConfig)
+	if err != nil {
+		return err
+	}
+
+	mechanism, err := newMechanism(ctx, &SASLAuthInfo{
+		Config:           c.config,
+		Conn:             c.conn,
+		Host:             connectConfig.originalHostname,
+		Password:         password,
+		ServerMechanisms: serverAuthMechanisms,
+	})
+	if err != nil {
+		return err
+	}
+
+	name, data, err := mechanism.Start()
+	if err != nil {
+		return err
+	}
+	c.frontend.Send(&pgproto3.SASLInitialResponse{AuthMechanism: name, Data: data})
+	err = c.flushWithPotentialWriteReadDeadlock()
+	if err != nil {
+		return err
+	}
+
+	err = c.saslExchange(mechanism)
+	if err != nil {
+		return err
+	}
+
+	if binder, ok := mechanism.(SASLChannelBinder); ok {
+		c.channelBound = binder.ChannelBound()
+	}
+	return nil
+}
+
+// saslExchange processes the server's SASL messages until the authentication exchange is complete.
+func (c *PgConn) saslExchange(mechanism SASLMechanism) error {
+	for {
+		// AuthenticationOk is left for the caller to receive.
+		msg, err := c.peekMessage()
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.AuthenticationOk); ok {
+			return mechanism.Final(nil)
+		}
+
+		msg, err = c.receiveMessage()
+		if err != nil {
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.AuthenticationSASLContinue:
+			data, err := mechanism.Continue(msg.Data)
+			if err != nil {
+				return err
+			}
+			c.frontend.Send(&pgproto3.SASLResponse{Data: data})
+			err = c.flushWithPotentialWriteReadDeadlock()
+			if err != nil {
+				return err
+			}
+		case *pgproto3.AuthenticationSASLFinal:
+			return mechanism.Final(msg.Data)
+		case *pgproto3.ErrorResponse:
+			return ErrorResponseToPgError(msg)
+		default:
+			return fmt.Errorf("received unexpected message %T during SASL authentication", msg)
+		}
+	}
+}
+
+func (c *PgConn) rxSASLContinue() (*pgproto3.AuthenticationSASLContinue, error) {
+	msg, err := c.receiveMessage()
+	if err != nil {
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *pgproto3.AuthenticationSASLContinue:
+		return m, nil
+	case *pgproto3.ErrorResponse:
+		return nil, ErrorResponseToPgError(m)
+	}
+
+	return nil, fmt.Errorf("expected AuthenticationSASLContinue message but received unexpected message %T", msg)
+}
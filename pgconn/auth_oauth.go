@@ -0,0 +1,169 @@
+// OAUTHBEARER authentication
+//
+// Resources:
+//   https://tools.ietf.org/html/rfc7628
+//   https://www.postgresql.org/docs/current/sasl-authentication.html#SASL-OAUTHBEARER
+
+package pgconn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+const oauthBearerName = "OAUTHBEARER"
+
+// oauthKVSep is the separator between the key/value pairs of an OAUTHBEARER client response.
+const oauthKVSep = "\x01"
+
+// OAuthTokenRequest describes the bearer token requested for OAUTHBEARER authentication.
+type OAuthTokenRequest struct {
+	// Host is the host being connected to.
+	Host string
+
+	// User is the database user being authenticated.
+	User string
+
+	// OpenIDConfiguration is the URL of the OpenID Connect discovery document of the issuer trusted by the server (e.g.
+	// https://example.com/.well-known/openid-configuration). Scope is the space separated list of scopes the server
+	// requires, if any. Both are empty until the server has reported them in a discovery response.
+	OpenIDConfiguration string
+	Scope               string
+}
+
+// OAuthTokenProviderFunc returns a bearer token for OAUTHBEARER authentication.
+//
+// It is first called with an OAuthTokenRequest without OpenIDConfiguration. It may return a previously obtained token or
+// an empty string. An empty string makes pgconn ask the server which issuer and scope it requires. The connection is then
+// made again and the function is called a second time with OpenIDConfiguration and Scope set. It is also called a
+// second time when the server rejects the token from the first call. A non-empty token must be returned from the second
+// call.
+type OAuthTokenProviderFunc func(ctx context.Context, req *OAuthTokenRequest) (string, error)
+
+// oauthDiscoveryError is returned by a connection attempt when the server rejected the OAUTHBEARER client response
+// and reported the issuer and scope it requires. The attempt can be repeated with a token for request.
+type oauthDiscoveryError struct {
+	request *OAuthTokenRequest
+	err     error
+}
+
+func (e *oauthDiscoveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *oauthDiscoveryError) Unwrap() error {
+	return e.err
+}
+
+// oauthServerError is the JSON error sent by the server in an AuthenticationSASLContinue when it rejects a bearer
+// token.
+type oauthServerError struct {
+	Status              string `json:"status"`
+	Scope               string `json:"scope"`
+	OpenIDConfiguration string `json:"openid-configuration"`
+}
+
+// useOAuthBearer returns true if OAUTHBEARER should be used with serverAuthMechanisms. It is preferred over registered
+// SASL mechanisms when Config.OAuthTokenProvider is set.
+func (c *PgConn) useOAuthBearer(serverAuthMechanisms []string) bool {
+	if !slices.Contains(serverAuthMechanisms, oauthBearerName) {
+		return false
+	}
+
+	return c.config.OAuthTokenProvider != nil || lookupSASLMechanism(serverAuthMechanisms) == nil
+}
+
+// Perform OAUTHBEARER authentication. tokenRequest is the request reported by the server in a previous attempt. It is
+// nil on the first attempt.
+func (c *PgConn) oauthBearerAuth(ctx context.Context, host string, tokenRequest *OAuthTokenRequest) error {
+	if c.config.OAuthTokenProvider == nil {
+		return errors.New("server requested OAUTHBEARER authentication but no OAuthTokenProvider is configured")
+	}
+
+	retryable := tokenRequest == nil
+	if tokenRequest == nil {
+		tokenRequest = &OAuthTokenRequest{Host: host, User: c.config.User}
+	}
+
+	token, err := c.config.OAuthTokenProvider(ctx, tokenRequest)
+	if err != nil {
+		return fmt.Errorf("OAuthTokenProvider failed: %w", err)
+	}
+	if token == "" && !retryable {
+		return errors.New("OAuthTokenProvider returned an empty token")
+	}
+
+	// An empty token makes the server report the issuer and scope it requires.
+	auth := ""
+	if token != "" {
+		auth = "Bearer " + token
+	}
+
+	c.frontend.Send(&pgproto3.SASLInitialResponse{
+		AuthMechanism: oauthBearerName,
+		Data:          []byte("n,," + oauthKVSep + "auth=" + auth + oauthKVSep + oauthKVSep),
+	})
+	err = c.flushWithPotentialWriteReadDeadlock()
+	if err != nil {
+		return err
+	}
+
+	// On success the server responds with AuthenticationOk. It is left for the caller to receive.
+	msg, err := c.peekMessage()
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*pgproto3.AuthenticationSASLContinue); !ok {
+		return nil
+	}
+
+	saslContinue, err := c.rxSASLContinue()
+	if err != nil {
+		return err
+	}
+	var serverErr oauthServerError
+	err = json.Unmarshal(saslContinue.Data, &serverErr)
+	if err != nil {
+		return fmt.Errorf("invalid OAUTHBEARER server error: %w", err)
+	}
+
+	// The server always fails authentication after an error. It must be acknowledged with a single separator.
+	c.frontend.Send(&pgproto3.SASLResponse{Data: []byte(oauthKVSep)})
+	err = c.flushWithPotentialWriteReadDeadlock()
+	if err != nil {
+		return err
+	}
+
+	// receiveMessage returns a FATAL error as err but other errors as msg.
+	msg, err = c.receiveMessage()
+	if err == nil {
+		errResp, ok := msg.(*pgproto3.ErrorResponse)
+		if !ok {
+			return fmt.Errorf("expected ErrorResponse message but received unexpected message %T", msg)
+		}
+		err = ErrorResponseToPgError(errResp)
+	}
+	var pgErr *PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if retryable && serverErr.OpenIDConfiguration != "" {
+		return &oauthDiscoveryError{
+			request: &OAuthTokenRequest{
+				Host:                tokenRequest.Host,
+				User:                tokenRequest.User,
+				OpenIDConfiguration: serverErr.OpenIDConfiguration,
+				Scope:               serverErr.Scope,
+			},
+			err: err,
+		}
+	}
+
+	return fmt.Errorf("server rejected OAuth bearer token (%s): %w", serverErr.Status, err)
+}
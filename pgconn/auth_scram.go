@@ -1,7 +1,8 @@
-// SCRAM-SHA-256 authentication
+// SCRAM-SHA-256 and SCRAM-SHA-256-PLUS authentication
 //
 // Resources:
 //   https://tools.ietf.org/html/rfc5802
+//   https://tools.ietf.org/html/rfc5929
 //   https://tools.ietf.org/html/rfc8265
 //   https://www.postgresql.org/docs/current/sasl-authentication.html
 //
@@ -14,95 +15,75 @@ package pgconn
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash"
+	"net"
 	"strconv"
 
-	"github.com/jackc/pgx/v5/pgproto3"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/text/secure/precis"
 )
 
 const clientNonceLen = 18
 
-// Perform SCRAM authentication.
-func (c *PgConn) scramAuth(serverAuthMechanisms []string) error {
-	sc, err := newScramClient(serverAuthMechanisms, c.config.Password)
-	if err != nil {
-		return err
-	}
+const (
+	scramSHA256Name     = "SCRAM-SHA-256"
+	scramSHA256PlusName = "SCRAM-SHA-256-PLUS"
+)
 
-	// Send client-first-message in a SASLInitialResponse
-	saslInitialResponse := &pgproto3.SASLInitialResponse{
-		AuthMechanism: "SCRAM-SHA-256",
-		Data:          sc.clientFirstMessage(),
-	}
-	c.frontend.Send(saslInitialResponse)
-	err = c.flushWithPotentialWriteReadDeadlock()
+// newScramMechanism creates a SCRAM-SHA-256 SASLMechanism. It is registered by default.
+func newScramMechanism(ctx context.Context, info *SASLAuthInfo) (SASLMechanism, error) {
+	sc, err := newScramClient(info.ServerMechanisms, info.Password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Receive server-first-message payload in an AuthenticationSASLContinue.
-	saslContinue, err := c.rxSASLContinue()
-	if err != nil {
-		return err
-	}
-	err = sc.recvServerFirstMessage(saslContinue.Data)
+	err = sc.configureChannelBinding(info.Conn, info.Config.ChannelBinding)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Send client-final-message in a SASLResponse
-	saslResponse := &pgproto3.SASLResponse{
-		Data: []byte(sc.clientFinalMessage()),
-	}
-	c.frontend.Send(saslResponse)
-	err = c.flushWithPotentialWriteReadDeadlock()
-	if err != nil {
-		return err
-	}
+	return sc, nil
+}
 
-	// Receive server-final-message payload in an AuthenticationSASLFinal.
-	saslFinal, err := c.rxSASLFinal()
-	if err != nil {
-		return err
-	}
-	return sc.recvServerFinalMessage(saslFinal.Data)
+// Start returns the client-first-message.
+func (sc *scramClient) Start() (string, []byte, error) {
+	return sc.authMechanism, sc.clientFirstMessage(), nil
 }
 
-func (c *PgConn) rxSASLContinue() (*pgproto3.AuthenticationSASLContinue, error) {
-	msg, err := c.receiveMessage()
-	if err != nil {
-		return nil, err
-	}
-	switch m := msg.(type) {
-	case *pgproto3.AuthenticationSASLContinue:
-		return m, nil
-	case *pgproto3.ErrorResponse:
-		return nil, ErrorResponseToPgError(m)
+// Continue receives the server-first-message and returns the client-final-message.
+func (sc *scramClient) Continue(data []byte) ([]byte, error) {
+	if sc.serverFirstMessage != nil {
+		return nil, errors.New("unexpected SCRAM server message: server-first-message already received")
 	}
 
-	return nil, fmt.Errorf("expected AuthenticationSASLContinue message but received unexpected message %T", msg)
-}
-
-func (c *PgConn) rxSASLFinal() (*pgproto3.AuthenticationSASLFinal, error) {
-	msg, err := c.receiveMessage()
+	err := sc.recvServerFirstMessage(data)
 	if err != nil {
 		return nil, err
 	}
-	switch m := msg.(type) {
-	case *pgproto3.AuthenticationSASLFinal:
-		return m, nil
-	case *pgproto3.ErrorResponse:
-		return nil, ErrorResponseToPgError(m)
+	return []byte(sc.clientFinalMessage()), nil
+}
+
+// Final receives the server-final-message.
+func (sc *scramClient) Final(data []byte) error {
+	if sc.authMessage == nil {
+		return errors.New("SCRAM authentication completed before client-final-message was sent")
 	}
+	return sc.recvServerFinalMessage(data)
+}
 
-	return nil, fmt.Errorf("expected AuthenticationSASLFinal message but received unexpected message %T", msg)
+// ChannelBound returns true if SCRAM-SHA-256-PLUS was used.
+func (sc *scramClient) ChannelBound() bool {
+	return sc.channelBindingData != nil
 }
 
 type scramClient struct {
@@ -110,6 +91,12 @@ type scramClient struct {
 	password             []byte
 	clientNonce          []byte
 
+	authMechanism string
+	gs2Header     []byte // GS2 header including channel binding flag (e.g. "n,,", "y,,", or "p=tls-server-end-point,,")
+
+	// channelBindingData is the tls-server-end-point channel binding data. It is nil when channel binding is not used.
+	channelBindingData []byte
+
 	clientFirstMessageBare []byte
 
 	serverFirstMessage   []byte
@@ -124,17 +111,12 @@ type scramClient struct {
 func newScramClient(serverAuthMechanisms []string, password string) (*scramClient, error) {
 	sc := &scramClient{
 		serverAuthMechanisms: serverAuthMechanisms,
+		authMechanism:        scramSHA256Name,
+		gs2Header:            []byte("n,,"),
 	}
 
 	// Ensure server supports SCRAM-SHA-256
-	hasScramSHA256 := false
-	for _, mech := range sc.serverAuthMechanisms {
-		if mech == "SCRAM-SHA-256" {
-			hasScramSHA256 = true
-			break
-		}
-	}
-	if !hasScramSHA256 {
+	if !sc.serverSupports(scramSHA256Name) {
 		return nil, errors.New("server does not support SCRAM-SHA-256")
 	}
 
@@ -157,9 +139,88 @@ func newScramClient(serverAuthMechanisms []string, password string) (*scramClien
 	return sc, nil
 }
 
+func (sc *scramClient) serverSupports(mechanism string) bool {
+	for _, mech := range sc.serverAuthMechanisms {
+		if mech == mechanism {
+			return true
+		}
+	}
+	return false
+}
+
+// configureChannelBinding selects between SCRAM-SHA-256 and SCRAM-SHA-256-PLUS based on whether conn is a TLS
+// connection, whether the server advertises SCRAM-SHA-256-PLUS, and the channelBinding setting (disable, prefer, or
+// require).
+func (sc *scramClient) configureChannelBinding(conn net.Conn, channelBinding string) error {
+	if channelBinding == "disable" {
+		return nil
+	}
+
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if !isTLS {
+		if channelBinding == "require" {
+			return errors.New("channel binding required but connection is not using TLS")
+		}
+		return nil
+	}
+
+	if !sc.serverSupports(scramSHA256PlusName) {
+		if channelBinding == "require" {
+			return errors.New("channel binding required but server does not support SCRAM-SHA-256-PLUS")
+		}
+		// Client supports channel binding but thinks the server does not. This allows the server to detect a downgrade
+		// attack where a man in the middle strips SCRAM-SHA-256-PLUS from the advertised mechanisms.
+		sc.gs2Header = []byte("y,,")
+		return nil
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("channel binding failed: server did not present a certificate")
+	}
+
+	cbindData, err := tlsServerEndPointData(certs[0])
+	if err != nil {
+		if channelBinding == "require" {
+			return err
+		}
+		// The server supports channel binding but it cannot be used with this certificate. Sending "y" would make the
+		// server reject the connection as a downgrade attack.
+		sc.gs2Header = []byte("n,,")
+		return nil
+	}
+
+	sc.authMechanism = scramSHA256PlusName
+	sc.gs2Header = []byte("p=tls-server-end-point,,")
+	sc.channelBindingData = cbindData
+
+	return nil
+}
+
+// tlsServerEndPointData computes the tls-server-end-point channel binding data for cert as specified in RFC 5929
+// section 4.1.
+func tlsServerEndPointData(cert *x509.Certificate) ([]byte, error) {
+	var h hash.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.DSAWithSHA256, x509.ECDSAWithSHA256:
+		// MD5 and SHA-1 are upgraded to SHA-256 per RFC 5929.
+		h = sha256.New()
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		h = sha512.New384()
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("channel binding failed: unsupported certificate signature algorithm %v", cert.SignatureAlgorithm)
+	}
+
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
 func (sc *scramClient) clientFirstMessage() []byte {
 	sc.clientFirstMessageBare = []byte(fmt.Sprintf("n=,r=%s", sc.clientNonce))
-	return []byte(fmt.Sprintf("n,,%s", sc.clientFirstMessageBare))
+	return []byte(fmt.Sprintf("%s%s", sc.gs2Header, sc.clientFirstMessageBare))
 }
 
 func (sc *scramClient) recvServerFirstMessage(serverFirstMessage []byte) error {
@@ -218,7 +279,9 @@ func (sc *scramClient) recvServerFirstMessage(serverFirstMessage []byte) error {
 }
 
 func (sc *scramClient) clientFinalMessage() string {
-	clientFinalMessageWithoutProof := []byte(fmt.Sprintf("c=biws,r=%s", sc.clientAndServerNonce))
+	cbindInput := append(append([]byte{}, sc.gs2Header...), sc.channelBindingData...)
+	channelBinding := base64.StdEncoding.EncodeToString(cbindInput)
+	clientFinalMessageWithoutProof := []byte(fmt.Sprintf("c=%s,r=%s", channelBinding, sc.clientAndServerNonce))
 
 	sc.saltedPassword = pbkdf2.Key([]byte(sc.password), sc.salt, sc.iterations, 32, sha256.New)
 	sc.authMessage = bytes.Join([][]byte{sc.clientFirstMessageBare, sc.serverFirstMessage, clientFinalMessageWithoutProof}, []byte(","))
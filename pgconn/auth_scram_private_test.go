@@ -0,0 +1,156 @@
+package pgconn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTLSConnPair returns a client TLS connection that has completed a handshake with a server using a freshly
+// generated self-signed ECDSA certificate. It also returns that certificate.
+func newTestTLSConnPair(t *testing.T) (*tls.Conn, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return newTestTLSConnPairWithKey(t, key)
+}
+
+// newTestTLSConnPairWithKey is like newTestTLSConnPair but the certificate is signed with key.
+func newTestTLSConnPairWithKey(t *testing.T, key crypto.Signer) (*tls.Conn, *x509.Certificate) {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	tlsServer := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	go tlsServer.Handshake()
+
+	tlsClient := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, tlsClient.Handshake())
+
+	return tlsClient, cert
+}
+
+func TestScramClientChannelBinding(t *testing.T) {
+	t.Parallel()
+
+	tlsConn, cert := newTestTLSConnPair(t)
+	certHash := sha256.Sum256(cert.Raw)
+
+	sc, err := newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(tlsConn, "prefer"))
+
+	assert.Equal(t, "SCRAM-SHA-256-PLUS", sc.authMechanism)
+	assert.Equal(t, certHash[:], sc.channelBindingData)
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "p=tls-server-end-point,,n=,r="))
+
+	sc.clientAndServerNonce = append(append([]byte{}, sc.clientNonce...), "server"...)
+	sc.salt = []byte("salt")
+	sc.iterations = 4096
+	expectedCBind := base64.StdEncoding.EncodeToString(append([]byte("p=tls-server-end-point,,"), certHash[:]...))
+	assert.True(t, strings.HasPrefix(sc.clientFinalMessage(), "c="+expectedCBind+",r="))
+}
+
+func TestScramClientChannelBindingServerDoesNotSupportPlus(t *testing.T) {
+	t.Parallel()
+
+	tlsConn, _ := newTestTLSConnPair(t)
+
+	sc, err := newScramClient([]string{"SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(tlsConn, "prefer"))
+	assert.Equal(t, "SCRAM-SHA-256", sc.authMechanism)
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "y,,n=,r="))
+
+	sc, err = newScramClient([]string{"SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.Error(t, sc.configureChannelBinding(tlsConn, "require"))
+}
+
+func TestScramClientChannelBindingDisabledOrWithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	tlsConn, _ := newTestTLSConnPair(t)
+
+	sc, err := newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(tlsConn, "disable"))
+	assert.Equal(t, "SCRAM-SHA-256", sc.authMechanism)
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "n,,n=,r="))
+
+	plainConn, otherConn := net.Pipe()
+	defer plainConn.Close()
+	defer otherConn.Close()
+
+	sc, err = newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(plainConn, "prefer"))
+	assert.Equal(t, "SCRAM-SHA-256", sc.authMechanism)
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "n,,n=,r="))
+
+	sc, err = newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.Error(t, sc.configureChannelBinding(plainConn, "require"))
+}
+
+func TestScramClientChannelBindingUnsupportedCertificate(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	tlsConn, cert := newTestTLSConnPairWithKey(t, key)
+	require.Equal(t, x509.PureEd25519, cert.SignatureAlgorithm)
+
+	// The server supports channel binding but the certificate hash cannot be computed so channel binding is not used.
+	// The client must not claim that it thinks the server does not support channel binding.
+	sc, err := newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(tlsConn, "prefer"))
+	assert.Equal(t, "SCRAM-SHA-256", sc.authMechanism)
+	assert.Nil(t, sc.channelBindingData)
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "n,,n=,r="))
+
+	sc, err = newScramClient([]string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.Error(t, sc.configureChannelBinding(tlsConn, "require"))
+
+	// The server does not advertise channel binding.
+	sc, err = newScramClient([]string{"SCRAM-SHA-256"}, "secret")
+	require.NoError(t, err)
+	require.NoError(t, sc.configureChannelBinding(tlsConn, "prefer"))
+	assert.True(t, strings.HasPrefix(string(sc.clientFirstMessage()), "y,,n=,r="))
+}
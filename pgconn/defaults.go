@@ -39,6 +39,12 @@ func defaultSettings() map[string]string {
 	}
 
 	settings["target_session_attrs"] = "any"
+	settings["channel_binding"] = "prefer"
+	settings["gssencmode"] = "prefer"
+	settings["sslnegotiation"] = "postgres"
+	settings["min_protocol_version"] = "3.0"
+	settings["max_protocol_version"] = "3.0"
+	settings["load_balance_hosts"] = "disable"
 
 	return settings
 }
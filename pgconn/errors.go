@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn/sqlstate"
 )
 
 // SafeToRetry checks if the err is guaranteed to have occurred before sending any data to the server.
@@ -59,6 +61,70 @@ func (pe *PgError) SQLState() string {
 	return pe.Code
 }
 
+// Class returns the SQLSTATE class of the error. It is the first two characters of Code. See the sqlstate package for
+// the classes.
+func (pe *PgError) Class() string {
+	return sqlstate.Class(pe.Code)
+}
+
+// ConditionName returns the PL/pgSQL condition name of Code (e.g. "unique_violation"). It returns an empty string if
+// Code is unknown.
+func (pe *PgError) ConditionName() string {
+	return sqlstate.ConditionName(pe.Code)
+}
+
+// ErrorSQLState returns the SQLSTATE of the *PgError in err's chain. It returns an empty string if there is none.
+func ErrorSQLState(err error) string {
+	var pgErr *PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// IsSQLStateClass checks if err was caused by a *PgError with a SQLSTATE in class (e.g.
+// sqlstate.ClassIntegrityConstraintViolation).
+func IsSQLStateClass(err error, class string) bool {
+	code := ErrorSQLState(err)
+	return code != "" && sqlstate.Class(code) == class
+}
+
+// IsUniqueViolation checks if err was caused by a *PgError with SQLSTATE unique_violation.
+func IsUniqueViolation(err error) bool {
+	return ErrorSQLState(err) == sqlstate.UniqueViolation
+}
+
+// IsForeignKeyViolation checks if err was caused by a *PgError with SQLSTATE foreign_key_violation.
+func IsForeignKeyViolation(err error) bool {
+	return ErrorSQLState(err) == sqlstate.ForeignKeyViolation
+}
+
+// IsNotNullViolation checks if err was caused by a *PgError with SQLSTATE not_null_violation.
+func IsNotNullViolation(err error) bool {
+	return ErrorSQLState(err) == sqlstate.NotNullViolation
+}
+
+// IsCheckViolation checks if err was caused by a *PgError with SQLSTATE check_violation.
+func IsCheckViolation(err error) bool {
+	return ErrorSQLState(err) == sqlstate.CheckViolation
+}
+
+// IsExclusionViolation checks if err was caused by a *PgError with SQLSTATE exclusion_violation.
+func IsExclusionViolation(err error) bool {
+	return ErrorSQLState(err) == sqlstate.ExclusionViolation
+}
+
+// IsSerializationFailure checks if err was caused by a *PgError with SQLSTATE serialization_failure. The transaction
+// can be retried.
+func IsSerializationFailure(err error) bool {
+	return ErrorSQLState(err) == sqlstate.SerializationFailure
+}
+
+// IsDeadlock checks if err was caused by a *PgError with SQLSTATE deadlock_detected. The transaction can be retried.
+func IsDeadlock(err error) bool {
+	return ErrorSQLState(err) == sqlstate.DeadlockDetected
+}
+
 // ConnectError is the error returned when a connection attempt fails.
 type ConnectError struct {
 	Config *Config // The configuration that was used in the connection attempt.
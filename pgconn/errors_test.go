@@ -1,10 +1,19 @@
 package pgconn_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/internal/pgmock"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/sqlstate"
+	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigError(t *testing.T) {
@@ -52,3 +61,95 @@ func TestConfigError(t *testing.T) {
 		})
 	}
 }
+
+func TestPgErrorSQLState(t *testing.T) {
+	t.Parallel()
+
+	pgErr := &pgconn.PgError{Severity: "ERROR", Code: "23505", Message: "duplicate key value violates unique constraint"}
+	err := fmt.Errorf("insert user: %w", pgErr)
+
+	assert.Equal(t, sqlstate.ClassIntegrityConstraintViolation, pgErr.Class())
+	assert.Equal(t, "unique_violation", pgErr.ConditionName())
+	assert.Equal(t, sqlstate.UniqueViolation, pgconn.ErrorSQLState(err))
+	assert.True(t, pgconn.IsUniqueViolation(err))
+	assert.True(t, pgconn.IsSQLStateClass(err, sqlstate.ClassIntegrityConstraintViolation))
+	assert.False(t, pgconn.IsSQLStateClass(err, sqlstate.ClassTransactionRollback))
+	assert.False(t, pgconn.IsForeignKeyViolation(err))
+	assert.False(t, pgconn.IsSerializationFailure(err))
+
+	assert.True(t, pgconn.IsSerializationFailure(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, pgconn.IsDeadlock(&pgconn.PgError{Code: "40P01"}))
+	assert.True(t, pgconn.IsNotNullViolation(&pgconn.PgError{Code: "23502"}))
+	assert.True(t, pgconn.IsCheckViolation(&pgconn.PgError{Code: "23514"}))
+	assert.True(t, pgconn.IsExclusionViolation(&pgconn.PgError{Code: "23P01"}))
+
+	otherErr := errors.New("not a PgError")
+	assert.Equal(t, "", pgconn.ErrorSQLState(otherErr))
+	assert.False(t, pgconn.IsUniqueViolation(otherErr))
+	assert.False(t, pgconn.IsSQLStateClass(otherErr, ""))
+	assert.False(t, pgconn.IsDeadlock(nil))
+	t.Run("ConnectError", func(t *testing.T) {
+		t.Parallel()
+
+		script := &pgmock.Script{Steps: []pgmock.Step{
+			pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+			pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed for user \"alice\""}),
+		}}
+		host, port, serverErrChan := startMockServer(t, script)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s user=alice", host, port))
+		require.NoError(t, <-serverErrChan)
+
+		var connectErr *pgconn.ConnectError
+		require.ErrorAs(t, err, &connectErr)
+		assert.Equal(t, sqlstate.InvalidPassword, pgconn.ErrorSQLState(err))
+		assert.True(t, pgconn.IsSQLStateClass(err, sqlstate.ClassInvalidAuthorizationSpecification))
+		assert.False(t, pgconn.IsUniqueViolation(err))
+	})
+
+	t.Run("pgx Exec and Query", func(t *testing.T) {
+		t.Parallel()
+
+		const sql = "insert into users (name) values ('alice')"
+		uniqueViolationSteps := []pgmock.Step{
+			pgmock.ExpectMessage(&pgproto3.Query{String: sql}),
+			pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "23505", Message: "duplicate key value violates unique constraint"}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		}
+		script := &pgmock.Script{Steps: []pgmock.Step{
+			pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+			pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
+			pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}),
+			pgmock.SendMessage(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"}),
+			pgmock.SendMessage(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		}}
+		script.Steps = append(script.Steps, uniqueViolationSteps...)
+		script.Steps = append(script.Steps, uniqueViolationSteps...)
+		script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+		host, port, serverErrChan := startMockServer(t, script)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn, err := pgx.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+		require.NoError(t, err)
+
+		_, execErr := conn.Exec(ctx, sql)
+		require.Error(t, execErr)
+		assert.Equal(t, sqlstate.UniqueViolation, pgconn.ErrorSQLState(fmt.Errorf("insert user: %w", execErr)))
+		assert.True(t, pgconn.IsUniqueViolation(execErr))
+
+		// The simple protocol reads the first result before Query returns so the error is returned by Query.
+		_, queryErr := conn.Query(ctx, sql, pgx.QueryExecModeSimpleProtocol)
+		require.Error(t, queryErr)
+		assert.Equal(t, sqlstate.UniqueViolation, pgconn.ErrorSQLState(queryErr))
+		assert.True(t, pgconn.IsSQLStateClass(queryErr, sqlstate.ClassIntegrityConstraintViolation))
+
+		require.NoError(t, conn.Close(ctx))
+		require.NoError(t, <-serverErrChan)
+	})
+}
@@ -0,0 +1,286 @@
+package pgconn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// gssEncMaxPacketSize is the maximum size of a GSSAPI encrypted packet including its 4 byte length prefix. It matches
+// PQ_GSS_MAX_PACKET_SIZE in libpq.
+const gssEncMaxPacketSize = 16 * 1024
+
+// gssEncMaxPlaintextSize is the maximum amount of plaintext sealed in a single packet. It leaves room for the overhead
+// that gss_wrap adds to each packet which for Kerberos is well under 100 bytes.
+const gssEncMaxPlaintextSize = gssEncMaxPacketSize - 1024
+
+var (
+	// errGSSEncRefused is returned by startGSSEnc when the server does not accept GSSAPI encryption. The connection can
+	// still be used for a SSLRequest or StartupMessage.
+	errGSSEncRefused = errors.New("server refused GSSAPI encryption")
+
+	// errGSSEncUnsupported is returned by startGSSEnc when the server does not understand the GSSEncRequest (e.g.
+	// PostgreSQL 11 and earlier). The server closes the connection.
+	errGSSEncUnsupported = errors.New("server does not support GSSAPI encryption")
+)
+
+// newGSSEncrypter returns the GSS provider to use for GSSAPI encryption or nil if GSSAPI encryption should not be
+// attempted.
+func newGSSEncrypter(gssEncMode string, network string) (GSSEncrypter, error) {
+	if gssEncMode == "" || gssEncMode == "disable" {
+		return nil, nil
+	}
+	require := gssEncMode == "require"
+
+	if network == "unix" {
+		if require {
+			return nil, errors.New("GSSAPI encryption is not supported over Unix domain sockets")
+		}
+		return nil, nil
+	}
+
+	if newGSS == nil {
+		if require {
+			return nil, errors.New("no GSSAPI provider registered, see https://github.com/otan/gopgkrb5")
+		}
+		return nil, nil
+	}
+
+	cli, err := newGSS()
+	if err != nil {
+		if require {
+			return nil, err
+		}
+		// Like libpq, silently skip GSSAPI encryption when credentials are not available.
+		return nil, nil
+	}
+
+	gssEncrypter, ok := cli.(GSSEncrypter)
+	if !ok {
+		if require {
+			return nil, errors.New("GSSAPI provider does not support encryption")
+		}
+		return nil, nil
+	}
+
+	return gssEncrypter, nil
+}
+
+// startGSSEnc sends a GSSEncRequest and establishes the GSS security context. On success it returns a net.Conn that
+// encrypts all traffic with cli.
+func startGSSEnc(conn net.Conn, cli GSSEncrypter, config *Config, host string) (net.Conn, error) {
+	buf, err := (&pgproto3.GSSEncRequest{}).Encode(nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 1)
+	if _, err = io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+
+	switch response[0] {
+	case 'G':
+	case 'N':
+		return nil, errGSSEncRefused
+	case 'E':
+		return nil, errGSSEncUnsupported
+	default:
+		return nil, fmt.Errorf("unexpected response to GSSEncRequest: %q", response[0])
+	}
+
+	token, err := gssInitToken(cli, config, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err = writeGSSEncPacket(conn, token)
+		if err != nil {
+			return nil, err
+		}
+
+		inToken, err := readGSSEncHandshakePacket(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		var done bool
+		done, token, err = cli.Continue(inToken)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			if len(token) > 0 {
+				err = writeGSSEncPacket(conn, token)
+				if err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+	}
+
+	return &gssEncConn{Conn: conn, gss: cli}, nil
+}
+
+func writeGSSEncPacket(conn net.Conn, token []byte) error {
+	if len(token)+4 > gssEncMaxPacketSize {
+		return fmt.Errorf("GSSAPI token too large: %d bytes", len(token))
+	}
+
+	buf := make([]byte, 0, 4+len(token))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(token)))
+	buf = append(buf, token...)
+	_, err := conn.Write(buf)
+	return err
+}
+
+// readGSSEncHandshakePacket reads a token sent by the server while establishing the GSS security context. The server
+// may instead send an ErrorResponse.
+func readGSSEncHandshakePacket(conn net.Conn) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+
+	// A token length is less than gssEncMaxPacketSize so its first byte is always 0. 'E' means an ErrorResponse.
+	if header[0] == 'E' {
+		lenBuf := make([]byte, 4)
+		copy(lenBuf, header[1:])
+		if _, err := io.ReadFull(conn, lenBuf[3:]); err != nil {
+			return nil, err
+		}
+		msgLen := int(binary.BigEndian.Uint32(lenBuf))
+		if msgLen < 4 || msgLen > gssEncMaxPacketSize {
+			return nil, fmt.Errorf("invalid ErrorResponse length during GSSAPI encryption negotiation: %d", msgLen)
+		}
+
+		body := make([]byte, msgLen-4)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+		var errResp pgproto3.ErrorResponse
+		if err := errResp.Decode(body); err != nil {
+			return nil, err
+		}
+		return nil, ErrorResponseToPgError(&errResp)
+	}
+
+	tokenLen := binary.BigEndian.Uint32(header)
+	if tokenLen+4 > gssEncMaxPacketSize {
+		return nil, fmt.Errorf("GSSAPI token too large: %d bytes", tokenLen)
+	}
+
+	token := make([]byte, tokenLen)
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// gssEncConn is a net.Conn that seals all data written and unseals all data read with a GSS security context. Each
+// packet consists of a 4 byte big endian length followed by a token produced by gss_wrap.
+type gssEncConn struct {
+	net.Conn
+	gss GSSEncrypter
+
+	// readBuf holds the raw bytes of a packet that has been partially read. It allows Read to resume after a deadline
+	// interrupts it in the middle of a packet.
+	readBuf   []byte
+	plaintext []byte
+	writeBuf  []byte
+}
+
+func (c *gssEncConn) Read(b []byte) (int, error) {
+	for len(c.plaintext) == 0 {
+		err := c.readPacket()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.plaintext)
+	c.plaintext = c.plaintext[n:]
+	return n, nil
+}
+
+func (c *gssEncConn) readPacket() error {
+	err := c.fill(4)
+	if err != nil {
+		return err
+	}
+
+	tokenLen := int(binary.BigEndian.Uint32(c.readBuf))
+	if tokenLen+4 > gssEncMaxPacketSize {
+		return fmt.Errorf("GSSAPI encrypted packet too large: %d bytes", tokenLen)
+	}
+
+	err = c.fill(4 + tokenLen)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := c.gss.Unwrap(c.readBuf[4:])
+	c.readBuf = c.readBuf[:0]
+	if err != nil {
+		return fmt.Errorf("failed to unwrap GSSAPI encrypted packet: %w", err)
+	}
+	c.plaintext = plaintext
+	return nil
+}
+
+// fill reads from the underlying connection until readBuf contains at least n bytes.
+func (c *gssEncConn) fill(n int) error {
+	if cap(c.readBuf) < n {
+		buf := make([]byte, len(c.readBuf), n)
+		copy(buf, c.readBuf)
+		c.readBuf = buf
+	}
+
+	for len(c.readBuf) < n {
+		m, err := c.Conn.Read(c.readBuf[len(c.readBuf):n])
+		c.readBuf = c.readBuf[:len(c.readBuf)+m]
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *gssEncConn) Write(b []byte) (int, error) {
+	c.writeBuf = c.writeBuf[:0]
+	for remaining := b; len(remaining) > 0; {
+		chunk := remaining
+		if len(chunk) > gssEncMaxPlaintextSize {
+			chunk = chunk[:gssEncMaxPlaintextSize]
+		}
+		remaining = remaining[len(chunk):]
+
+		token, err := c.gss.Wrap(chunk)
+		if err != nil {
+			return 0, fmt.Errorf("failed to wrap GSSAPI encrypted packet: %w", err)
+		}
+		if len(token)+4 > gssEncMaxPacketSize {
+			return 0, fmt.Errorf("GSSAPI encrypted packet too large: %d bytes", len(token))
+		}
+
+		c.writeBuf = binary.BigEndian.AppendUint32(c.writeBuf, uint32(len(token)))
+		c.writeBuf = append(c.writeBuf, token...)
+	}
+
+	_, err := c.Conn.Write(c.writeBuf)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,309 @@
+package pgconn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGSSEncrypter is a GSSEncrypter that "seals" data by XORing it with a fixed key. It accepts a security context
+// as soon as the server replies with "accept".
+type fakeGSSEncrypter struct{}
+
+func (fakeGSSEncrypter) GetInitToken(host string, service string) ([]byte, error) {
+	return []byte("init:" + service + "@" + host), nil
+}
+
+func (fakeGSSEncrypter) GetInitTokenFromSPN(spn string) ([]byte, error) {
+	return []byte("init:" + spn), nil
+}
+
+func (fakeGSSEncrypter) Continue(inToken []byte) (bool, []byte, error) {
+	if string(inToken) != "accept" {
+		return false, nil, errors.New("unexpected token")
+	}
+	return true, nil, nil
+}
+
+func (fakeGSSEncrypter) Wrap(plaintext []byte) ([]byte, error) {
+	token := append([]byte("w"), plaintext...)
+	for i := 1; i < len(token); i++ {
+		token[i] ^= 0x5a
+	}
+	return token, nil
+}
+
+func (fakeGSSEncrypter) Unwrap(token []byte) ([]byte, error) {
+	if len(token) == 0 || token[0] != 'w' {
+		return nil, errors.New("invalid token")
+	}
+	plaintext := make([]byte, len(token)-1)
+	for i := range plaintext {
+		plaintext[i] = token[i+1] ^ 0x5a
+	}
+	return plaintext, nil
+}
+
+// fakeGSS is a GSS provider that does not support encryption.
+type fakeGSS struct{}
+
+func (fakeGSS) GetInitToken(host string, service string) ([]byte, error) { return nil, nil }
+func (fakeGSS) GetInitTokenFromSPN(spn string) ([]byte, error)           { return nil, nil }
+func (fakeGSS) Continue(inToken []byte) (bool, []byte, error)            { return true, nil, nil }
+
+// failingGSSEncrypter is a fakeGSSEncrypter that fails to establish a security context.
+type failingGSSEncrypter struct {
+	fakeGSSEncrypter
+}
+
+func (failingGSSEncrypter) Continue(inToken []byte) (bool, []byte, error) {
+	return false, nil, errors.New("security context rejected")
+}
+
+func registerTestGSSProvider(t *testing.T, gss GSS) {
+	prevNewGSS := newGSS
+	t.Cleanup(func() { newGSS = prevNewGSS })
+	RegisterGSSProvider(func() (GSS, error) { return gss, nil })
+}
+
+func TestGSSEncConnRoundTrip(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	client := &gssEncConn{Conn: clientConn, gss: fakeGSSEncrypter{}}
+	server := &gssEncConn{Conn: serverConn, gss: fakeGSSEncrypter{}}
+
+	// Larger than a single packet.
+	data := bytes.Repeat([]byte("0123456789"), 4000)
+
+	writeErrChan := make(chan error, 1)
+	go func() {
+		_, err := client.Write(data)
+		writeErrChan <- err
+	}()
+
+	received := make([]byte, len(data))
+	_, err := io.ReadFull(server, received)
+	require.NoError(t, err)
+	require.NoError(t, <-writeErrChan)
+	assert.Equal(t, data, received)
+}
+
+func TestGSSEncConnReadResumesAfterDeadline(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	client := &gssEncConn{Conn: clientConn, gss: fakeGSSEncrypter{}}
+
+	token, err := fakeGSSEncrypter{}.Wrap([]byte("hello"))
+	require.NoError(t, err)
+	packet := append([]byte{0, 0, 0, byte(len(token))}, token...)
+
+	go serverConn.Write(packet[:5])
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	buf := make([]byte, 16)
+	_, err = client.Read(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	go serverConn.Write(packet[5:])
+
+	require.NoError(t, client.SetReadDeadline(time.Time{}))
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+}
+
+func TestNewGSSEncrypter(t *testing.T) {
+	prevNewGSS := newGSS
+	t.Cleanup(func() { newGSS = prevNewGSS })
+
+	newGSS = nil
+	gssEncrypter, err := newGSSEncrypter("prefer", "tcp")
+	require.NoError(t, err)
+	assert.Nil(t, gssEncrypter)
+	_, err = newGSSEncrypter("require", "tcp")
+	require.Error(t, err)
+
+	RegisterGSSProvider(func() (GSS, error) { return fakeGSS{}, nil })
+	gssEncrypter, err = newGSSEncrypter("prefer", "tcp")
+	require.NoError(t, err)
+	assert.Nil(t, gssEncrypter)
+	_, err = newGSSEncrypter("require", "tcp")
+	require.Error(t, err)
+
+	RegisterGSSProvider(func() (GSS, error) { return fakeGSSEncrypter{}, nil })
+	gssEncrypter, err = newGSSEncrypter("prefer", "tcp")
+	require.NoError(t, err)
+	assert.NotNil(t, gssEncrypter)
+	gssEncrypter, err = newGSSEncrypter("disable", "tcp")
+	require.NoError(t, err)
+	assert.Nil(t, gssEncrypter)
+	gssEncrypter, err = newGSSEncrypter("prefer", "unix")
+	require.NoError(t, err)
+	assert.Nil(t, gssEncrypter)
+	_, err = newGSSEncrypter("require", "unix")
+	require.Error(t, err)
+}
+
+// connectGSSEncTest connects with connString to a server that runs serve on the raw network connection. If the client
+// dials more than once each connection is served by the next function in serves.
+func connectGSSEncTest(t *testing.T, connString string, serves ...func(conn net.Conn) error) (*PgConn, error, chan error) {
+	config, err := ParseConfig(connString)
+	require.NoError(t, err)
+
+	serverErrChan := make(chan error, len(serves))
+	config.LookupFunc = func(ctx context.Context, host string) ([]string, error) { return []string{"127.0.0.1"}, nil }
+	config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if len(serves) == 0 {
+			return nil, errors.New("unexpected dial")
+		}
+		serve := serves[0]
+		serves = serves[1:]
+
+		clientConn, serverConn := net.Pipe()
+		t.Cleanup(func() { serverConn.Close() })
+		go func() {
+			serverErrChan <- serve(serverConn)
+		}()
+		return clientConn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := ConnectConfig(ctx, config)
+	return conn, err, serverErrChan
+}
+
+func TestConnectGSSEnc(t *testing.T) {
+	registerTestGSSProvider(t, fakeGSSEncrypter{})
+
+	conn, err, serverErrChan := connectGSSEncTest(t, "host=db.example.com sslmode=disable gssencmode=require", func(conn net.Conn) error {
+		backend := pgproto3.NewBackend(conn, conn)
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.GSSEncRequest); !ok {
+			return errors.New("expected GSSEncRequest")
+		}
+		if _, err := conn.Write([]byte{'G'}); err != nil {
+			return err
+		}
+
+		token, err := readGSSEncHandshakePacket(conn)
+		if err != nil {
+			return err
+		}
+		if string(token) != "init:postgres@db.example.com" {
+			return errors.New("unexpected init token")
+		}
+		if err := writeGSSEncPacket(conn, []byte("accept")); err != nil {
+			return err
+		}
+
+		encConn := &gssEncConn{Conn: conn, gss: fakeGSSEncrypter{}}
+		script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+		script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+		return script.Run(pgproto3.NewBackend(encConn, encConn))
+	})
+	require.NoError(t, err)
+
+	_, ok := conn.Conn().(*gssEncConn)
+	assert.True(t, ok)
+
+	require.NoError(t, conn.Close(context.Background()))
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestConnectGSSEncRefused(t *testing.T) {
+	registerTestGSSProvider(t, fakeGSSEncrypter{})
+
+	refuse := func(conn net.Conn, steps ...pgmock.Step) error {
+		backend := pgproto3.NewBackend(conn, conn)
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.GSSEncRequest); !ok {
+			return errors.New("expected GSSEncRequest")
+		}
+		if _, err := conn.Write([]byte{'N'}); err != nil {
+			return err
+		}
+		return (&pgmock.Script{Steps: steps}).Run(backend)
+	}
+
+	steps := append(pgmock.AcceptUnauthenticatedConnRequestSteps(), pgmock.ExpectMessage(&pgproto3.Terminate{}))
+	conn, err, serverErrChan := connectGSSEncTest(t, "host=localhost sslmode=disable gssencmode=prefer", func(conn net.Conn) error {
+		return refuse(conn, steps...)
+	})
+	require.NoError(t, err)
+	_, ok := conn.Conn().(*gssEncConn)
+	assert.False(t, ok)
+	require.NoError(t, conn.Close(context.Background()))
+	require.NoError(t, <-serverErrChan)
+
+	_, err, _ = connectGSSEncTest(t, "host=localhost sslmode=disable gssencmode=require", func(conn net.Conn) error {
+		return refuse(conn)
+	})
+	require.ErrorIs(t, err, errGSSEncRefused)
+}
+
+func TestConnectGSSEncFailureFallsBack(t *testing.T) {
+	registerTestGSSProvider(t, failingGSSEncrypter{})
+
+	failHandshake := func(conn net.Conn) error {
+		backend := pgproto3.NewBackend(conn, conn)
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.GSSEncRequest); !ok {
+			return errors.New("expected GSSEncRequest")
+		}
+		if _, err := conn.Write([]byte{'G'}); err != nil {
+			return err
+		}
+		if _, err := readGSSEncHandshakePacket(conn); err != nil {
+			return err
+		}
+		if err := writeGSSEncPacket(conn, []byte("challenge")); err != nil {
+			return err
+		}
+		// The client closes the connection after its GSS provider fails.
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			return errors.New("expected the client to close the connection")
+		}
+		return nil
+	}
+	accept := func(conn net.Conn) error {
+		script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+		script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+		return script.Run(pgproto3.NewBackend(conn, conn))
+	}
+
+	conn, err, serverErrChan := connectGSSEncTest(t, "host=localhost sslmode=disable gssencmode=prefer", failHandshake, accept)
+	require.NoError(t, err)
+	_, ok := conn.Conn().(*gssEncConn)
+	assert.False(t, ok)
+	require.NoError(t, conn.Close(context.Background()))
+	require.NoError(t, <-serverErrChan)
+	require.NoError(t, <-serverErrChan)
+
+	_, err, serverErrChan = connectGSSEncTest(t, "host=localhost sslmode=disable gssencmode=require", failHandshake)
+	require.ErrorContains(t, err, "security context rejected")
+	require.NoError(t, <-serverErrChan)
+}
@@ -2,9 +2,11 @@ package pgconn_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/internal/pgmock"
 	"github.com/jackc/pgx/v5/pgconn"
 
 	"github.com/stretchr/testify/assert"
@@ -34,3 +36,19 @@ func ensureConnValid(t *testing.T, pgConn *pgconn.PgConn) {
 	assert.Equal(t, "2", string(result.Rows[1][0]))
 	assert.Equal(t, "3", string(result.Rows[2][0]))
 }
+
+// startMockServer starts a server on a random local TCP port that runs script against the first connection it accepts.
+// It returns the host and port of the server and a channel that receives the result of running the script.
+func startMockServer(t testing.TB, script *pgmock.Script) (host, port string, serverErrChan chan error) {
+	return startMockServerScripts(t, script)
+}
+
+// startMockServerScripts is like startMockServer but runs each script against a successively accepted connection.
+func startMockServerScripts(t testing.TB, scripts ...*pgmock.Script) (host, port string, serverErrChan chan error) {
+	ln, serverErrChan, err := pgmock.Serve(scripts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ = strings.Cut(ln.Addr().String(), ":")
+	return host, port, serverErrChan
+}
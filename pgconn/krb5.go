@@ -33,6 +33,18 @@ type GSS interface {
 	Continue(inToken []byte) (done bool, outToken []byte, err error)
 }
 
+// GSSEncrypter is a GSS provider that also supports GSSAPI transport encryption (gssencmode). Once the security
+// context is established, all traffic is sealed with Wrap and unsealed with Unwrap.
+type GSSEncrypter interface {
+	GSS
+
+	// Wrap seals plaintext with confidentiality (i.e. gss_wrap with conf_req_flag set).
+	Wrap(plaintext []byte) ([]byte, error)
+
+	// Unwrap unseals a token created by the server's gss_wrap.
+	Unwrap(token []byte) ([]byte, error)
+}
+
 func (c *PgConn) gssAuth() error {
 	if newGSS == nil {
 		return errors.New("kerberos error: no GSSAPI provider registered, see https://github.com/otan/gopgkrb5")
@@ -42,18 +54,7 @@ func (c *PgConn) gssAuth() error {
 		return err
 	}
 
-	var nextData []byte
-	if c.config.KerberosSpn != "" {
-		// Use the supplied SPN if provided.
-		nextData, err = cli.GetInitTokenFromSPN(c.config.KerberosSpn)
-	} else {
-		// Allow the kerberos service name to be overridden
-		service := "postgres"
-		if c.config.KerberosSrvName != "" {
-			service = c.config.KerberosSrvName
-		}
-		nextData, err = cli.GetInitToken(c.config.Host, service)
-	}
+	nextData, err := gssInitToken(cli, c.config, c.config.Host)
 	if err != nil {
 		return err
 	}
@@ -83,6 +84,21 @@ func (c *PgConn) gssAuth() error {
 	return nil
 }
 
+// gssInitToken returns the initial token of the GSS security context for host.
+func gssInitToken(cli GSS, config *Config, host string) ([]byte, error) {
+	if config.KerberosSpn != "" {
+		// Use the supplied SPN if provided.
+		return cli.GetInitTokenFromSPN(config.KerberosSpn)
+	}
+
+	// Allow the kerberos service name to be overridden
+	service := "postgres"
+	if config.KerberosSrvName != "" {
+		service = config.KerberosSrvName
+	}
+	return cli.GetInitToken(host, service)
+}
+
 func (c *PgConn) rxGSSContinue() (*pgproto3.AuthenticationGSSContinue, error) {
 	msg, err := c.receiveMessage()
 	if err != nil {
@@ -1,6 +1,7 @@
 package pgconn
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/tls"
@@ -10,7 +11,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -74,9 +77,11 @@ type NotificationHandler func(*PgConn, *Notification)
 type PgConn struct {
 	conn              net.Conn
 	pid               uint32            // backend pid
-	secretKey         uint32            // key to use to send a cancel query message to the server
+	secretKey         []byte            // key to use to send a cancel query message to the server
+	protocolVersion   uint32            // negotiated wire protocol version (e.g. pgproto3.ProtocolVersion30)
 	parameterStatuses map[string]string // parameters that have been reported by the server
 	txStatus          byte
+	channelBound      bool // true if SCRAM-SHA-256-PLUS authentication with channel binding succeeded
 	frontend          *pgproto3.Frontend
 	bgReader          *bgreader.BGReader
 	slowWriteTimer    *time.Timer
@@ -184,6 +189,10 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 	}
 	fallbackConfigs = append(fallbackConfigs, config.Fallbacks...)
 
+	if config.LoadBalanceHosts == "random" {
+		fallbackConfigs = shuffleFallbackConfigs(fallbackConfigs)
+	}
+
 	var configs []*connectOneConfig
 
 	var allErrors []error
@@ -196,6 +205,7 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 				network:          network,
 				address:          address,
 				originalHostname: fb.Host,
+				port:             fb.Port,
 				tlsConfig:        fb.TLSConfig,
 			})
 
@@ -208,6 +218,11 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 			continue
 		}
 
+		if config.LoadBalanceHosts == "random" {
+			ips = slices.Clone(ips)
+			rand.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+		}
+
 		for _, ip := range ips {
 			splitIP, splitPort, err := net.SplitHostPort(ip)
 			if err == nil {
@@ -220,6 +235,7 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 					network:          network,
 					address:          address,
 					originalHostname: fb.Host,
+					port:             uint16(port),
 					tlsConfig:        fb.TLSConfig,
 				})
 			} else {
@@ -228,6 +244,7 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 					network:          network,
 					address:          address,
 					originalHostname: fb.Host,
+					port:             fb.Port,
 					tlsConfig:        fb.TLSConfig,
 				})
 			}
@@ -237,6 +254,27 @@ func buildConnectOneConfigs(ctx context.Context, config *Config) ([]*connectOneC
 	return configs, allErrors
 }
 
+// shuffleFallbackConfigs returns fallbackConfigs with the hosts in random order. Adjacent configs for the same host and
+// port (e.g. the TLS and non-TLS attempts of sslmode=prefer) are kept together and in their original order.
+func shuffleFallbackConfigs(fallbackConfigs []*FallbackConfig) []*FallbackConfig {
+	var groups [][]*FallbackConfig
+	for i, fb := range fallbackConfigs {
+		if i > 0 && fb.Host == fallbackConfigs[i-1].Host && fb.Port == fallbackConfigs[i-1].Port {
+			groups[len(groups)-1] = append(groups[len(groups)-1], fb)
+		} else {
+			groups = append(groups, []*FallbackConfig{fb})
+		}
+	}
+
+	rand.Shuffle(len(groups), func(i, j int) { groups[i], groups[j] = groups[j], groups[i] })
+
+	shuffled := make([]*FallbackConfig, 0, len(fallbackConfigs))
+	for _, group := range groups {
+		shuffled = append(shuffled, group...)
+	}
+	return shuffled
+}
+
 // connectPreferred attempts to connect to the preferred host from connectOneConfigs. The connections are attempted in
 // order. If a connection is successful it is returned. If no connection is successful then all errors are returned. If
 // a connection attempt returns a [NotPreferredError], then that host will be used if no other hosts are successful.
@@ -296,9 +334,23 @@ func connectPreferred(ctx context.Context, config *Config, connectOneConfigs []*
 	return nil, allErrors
 }
 
-// connectOne makes one connection attempt to a single host.
+// connectOne makes one connection attempt to a single host. If the server rejects OAUTHBEARER authentication and
+// reports the issuer and scope it requires then a second attempt is made with a token for that issuer and scope.
 func connectOne(ctx context.Context, config *Config, connectConfig *connectOneConfig,
 	ignoreNotPreferredErr bool,
+) (*PgConn, error) {
+	pgConn, err := connectOneAttempt(ctx, config, connectConfig, ignoreNotPreferredErr)
+	var discoveryErr *oauthDiscoveryError
+	if errors.As(err, &discoveryErr) {
+		retryConfig := *connectConfig
+		retryConfig.oauthTokenRequest = discoveryErr.request
+		pgConn, err = connectOneAttempt(ctx, config, &retryConfig, ignoreNotPreferredErr)
+	}
+	return pgConn, err
+}
+
+func connectOneAttempt(ctx context.Context, config *Config, connectConfig *connectOneConfig,
+	ignoreNotPreferredErr bool,
 ) (*PgConn, error) {
 	pgConn := new(PgConn)
 	pgConn.config = config
@@ -318,10 +370,50 @@ func connectOne(ctx context.Context, config *Config, connectConfig *connectOneCo
 		return nil, newPerDialConnectError("dial error", err)
 	}
 
-	if connectConfig.tlsConfig != nil {
+	gssEncrypter, err := newGSSEncrypter(config.GSSEncMode, connectConfig.network)
+	if err != nil {
+		pgConn.conn.Close()
+		return nil, newPerDialConnectError("gss encryption error", err)
+	}
+
+	directTLS := connectConfig.tlsConfig != nil && config.SSLNegotiation == "direct"
+
+	var gssEncrypted bool
+	if gssEncrypter != nil {
 		pgConn.contextWatcher = ctxwatch.NewContextWatcher(&DeadlineContextWatcherHandler{Conn: pgConn.conn})
 		pgConn.contextWatcher.Watch(ctx)
-		tlsConn, err := startTLS(pgConn.conn, connectConfig.tlsConfig)
+		gssConn, err := startGSSEnc(pgConn.conn, gssEncrypter, config, connectConfig.originalHostname)
+		pgConn.contextWatcher.Unwatch() // Always unwatch `netConn` after GSS encryption negotiation.
+		switch {
+		case err == nil:
+			pgConn.conn = gssConn
+			gssEncrypted = true
+		case config.GSSEncMode == "prefer" && errors.Is(err, errGSSEncRefused) && !directTLS:
+			// Continue with TLS or an unencrypted connection on the same network connection.
+		case config.GSSEncMode == "prefer":
+			// Like libpq, give up on GSSAPI encryption and continue on a new connection. The server closes the connection
+			// after rejecting an unsupported GSSEncRequest, direct TLS must begin at the start of a connection, and a failed
+			// security context exchange leaves the connection in an unknown state.
+			pgConn.conn.Close()
+			pgConn.conn, err = config.DialFunc(ctx, connectConfig.network, connectConfig.address)
+			if err != nil {
+				return nil, newPerDialConnectError("dial error", err)
+			}
+		default:
+			pgConn.conn.Close()
+			return nil, newPerDialConnectError("gss encryption error", err)
+		}
+	}
+
+	if connectConfig.tlsConfig != nil && !gssEncrypted {
+		pgConn.contextWatcher = ctxwatch.NewContextWatcher(&DeadlineContextWatcherHandler{Conn: pgConn.conn})
+		pgConn.contextWatcher.Watch(ctx)
+		var tlsConn net.Conn
+		if directTLS {
+			tlsConn, err = startDirectTLS(pgConn.conn, connectConfig.tlsConfig)
+		} else {
+			tlsConn, err = startTLS(pgConn.conn, connectConfig.tlsConfig)
+		}
 		pgConn.contextWatcher.Unwatch() // Always unwatch `netConn` after TLS.
 		if err != nil {
 			pgConn.conn.Close()
@@ -348,8 +440,20 @@ func connectOne(ctx context.Context, config *Config, connectConfig *connectOneCo
 	pgConn.bgReaderStarted = make(chan struct{})
 	pgConn.frontend = config.BuildFrontend(pgConn.bgReader, pgConn.conn)
 
+	minProtocolVersion, err := parseProtocolVersion(config.MinProtocolVersion)
+	if err != nil {
+		pgConn.conn.Close()
+		return nil, newPerDialConnectError("invalid MinProtocolVersion", err)
+	}
+	maxProtocolVersion, err := parseProtocolVersion(config.MaxProtocolVersion)
+	if err != nil {
+		pgConn.conn.Close()
+		return nil, newPerDialConnectError("invalid MaxProtocolVersion", err)
+	}
+	pgConn.protocolVersion = maxProtocolVersion
+
 	startupMsg := pgproto3.StartupMessage{
-		ProtocolVersion: pgproto3.ProtocolVersionNumber,
+		ProtocolVersion: maxProtocolVersion,
 		Parameters:      make(map[string]string),
 	}
 
@@ -382,24 +486,49 @@ func connectOne(ctx context.Context, config *Config, connectConfig *connectOneCo
 		switch msg := msg.(type) {
 		case *pgproto3.BackendKeyData:
 			pgConn.pid = msg.ProcessID
-			pgConn.secretKey = msg.SecretKey
+			// msg.SecretKey references the read buffer so it must be copied.
+			pgConn.secretKey = bytes.Clone(msg.SecretKey)
 
+		case *pgproto3.NegotiateProtocolVersion:
+			err = pgConn.negotiateProtocolVersion(msg, minProtocolVersion)
+			if err != nil {
+				pgConn.conn.Close()
+				return nil, newPerDialConnectError("protocol version negotiation failed", err)
+			}
 		case *pgproto3.AuthenticationOk:
+			if config.ChannelBinding == "require" && !pgConn.channelBound {
+				pgConn.conn.Close()
+				return nil, newPerDialConnectError("channel binding required", errors.New("server authenticated client without channel binding"))
+			}
 		case *pgproto3.AuthenticationCleartextPassword:
-			err = pgConn.txPasswordMessage(pgConn.config.Password)
+			password, err := pgConn.authPassword(ctx, connectConfig)
+			if err != nil {
+				pgConn.conn.Close()
+				return nil, newPerDialConnectError("failed to get password", err)
+			}
+			err = pgConn.txPasswordMessage(password)
 			if err != nil {
 				pgConn.conn.Close()
 				return nil, newPerDialConnectError("failed to write password message", err)
 			}
 		case *pgproto3.AuthenticationMD5Password:
-			digestedPassword := "md5" + hexMD5(hexMD5(pgConn.config.Password+pgConn.config.User)+string(msg.Salt[:]))
+			password, err := pgConn.authPassword(ctx, connectConfig)
+			if err != nil {
+				pgConn.conn.Close()
+				return nil, newPerDialConnectError("failed to get password", err)
+			}
+			digestedPassword := "md5" + hexMD5(hexMD5(password+pgConn.config.User)+string(msg.Salt[:]))
 			err = pgConn.txPasswordMessage(digestedPassword)
 			if err != nil {
 				pgConn.conn.Close()
 				return nil, newPerDialConnectError("failed to write password message", err)
 			}
 		case *pgproto3.AuthenticationSASL:
-			err = pgConn.scramAuth(msg.AuthMechanisms)
+			if pgConn.useOAuthBearer(msg.AuthMechanisms) {
+				err = pgConn.oauthBearerAuth(ctx, connectConfig.originalHostname, connectConfig.oauthTokenRequest)
+			} else {
+				err = pgConn.saslAuth(ctx, connectConfig, msg.AuthMechanisms)
+			}
 			if err != nil {
 				pgConn.conn.Close()
 				return nil, newPerDialConnectError("failed SASL auth", err)
@@ -442,6 +571,29 @@ func connectOne(ctx context.Context, config *Config, connectConfig *connectOneCo
 	}
 }
 
+// negotiateProtocolVersion handles the server's response to a StartupMessage requesting a protocol version or options
+// that it does not support.
+func (pgConn *PgConn) negotiateProtocolVersion(msg *pgproto3.NegotiateProtocolVersion, minProtocolVersion uint32) error {
+	serverVersion := pgproto3.ProtocolVersion30&^0xFFFF | msg.NewestMinorProtocol
+
+	if serverVersion >= pgConn.protocolVersion {
+		return fmt.Errorf("server requested protocol version 3.%d which is not older than the requested version", msg.NewestMinorProtocol)
+	}
+	// Protocol version 3.1 was never used by any server.
+	if msg.NewestMinorProtocol == 1 {
+		return errors.New("server requested invalid protocol version 3.1")
+	}
+	if len(msg.UnrecognizedOptions) > 0 {
+		return fmt.Errorf("server did not recognize protocol options: %s", strings.Join(msg.UnrecognizedOptions, ", "))
+	}
+	if serverVersion < minProtocolVersion {
+		return fmt.Errorf("server only supports protocol version 3.%d but the minimum protocol version is 3.%d", msg.NewestMinorProtocol, minProtocolVersion&0xFFFF)
+	}
+
+	pgConn.protocolVersion = serverVersion
+	return nil
+}
+
 func startTLS(conn net.Conn, tlsConfig *tls.Config) (net.Conn, error) {
 	err := binary.Write(conn, binary.BigEndian, []int32{8, 80877103})
 	if err != nil {
@@ -460,6 +612,28 @@ func startTLS(conn net.Conn, tlsConfig *tls.Config) (net.Conn, error) {
 	return tls.Client(conn, tlsConfig), nil
 }
 
+// startDirectTLS performs a TLS handshake without first sending an SSLRequest. The server must select the
+// "postgresql" ALPN protocol.
+func startDirectTLS(conn net.Conn, tlsConfig *tls.Config) (net.Conn, error) {
+	if !slices.Contains(tlsConfig.NextProtos, "postgresql") {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, "postgresql")
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	err := tlsConn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConn.ConnectionState().NegotiatedProtocol != "postgresql" {
+		tlsConn.Close()
+		return nil, errors.New("server did not select ALPN protocol \"postgresql\" for direct TLS connection")
+	}
+
+	return tlsConn, nil
+}
+
 func (pgConn *PgConn) txPasswordMessage(password string) (err error) {
 	pgConn.frontend.Send(&pgproto3.PasswordMessage{Password: password})
 	return pgConn.flushWithPotentialWriteReadDeadlock()
@@ -620,8 +794,14 @@ func (pgConn *PgConn) TxStatus() byte {
 	return pgConn.txStatus
 }
 
-// SecretKey returns the backend secret key used to send a cancel query message to the server.
-func (pgConn *PgConn) SecretKey() uint32 {
+// ProtocolVersion returns the wire protocol version negotiated with the server (e.g. pgproto3.ProtocolVersion32).
+func (pgConn *PgConn) ProtocolVersion() uint32 {
+	return pgConn.protocolVersion
+}
+
+// SecretKey returns the backend secret key used to send a cancel query message to the server. It is 4 bytes for protocol
+// 3.0 and up to 256 bytes for protocol 3.2.
+func (pgConn *PgConn) SecretKey() []byte {
 	return pgConn.secretKey
 }
 
@@ -909,6 +1089,12 @@ readloop:
 //   - Deallocate can succeed in an aborted transaction.
 //   - Deallocating a non-existent prepared statement is not an error.
 func (pgConn *PgConn) Deallocate(ctx context.Context, name string) error {
+	return pgConn.close(ctx, 'S', name)
+}
+
+// close closes the prepared statement or portal name with the Close protocol message. objectType is 'S' for a
+// prepared statement or 'P' for a portal.
+func (pgConn *PgConn) close(ctx context.Context, objectType byte, name string) error {
 	if err := pgConn.lock(); err != nil {
 		return err
 	}
@@ -924,7 +1110,7 @@ func (pgConn *PgConn) Deallocate(ctx context.Context, name string) error {
 		defer pgConn.contextWatcher.Unwatch()
 	}
 
-	pgConn.frontend.SendClose(&pgproto3.Close{ObjectType: 'S', Name: name})
+	pgConn.frontend.SendClose(&pgproto3.Close{ObjectType: objectType, Name: name})
 	pgConn.frontend.SendSync(&pgproto3.Sync{})
 	err := pgConn.flushWithPotentialWriteReadDeadlock()
 	if err != nil {
@@ -948,6 +1134,86 @@ func (pgConn *PgConn) Deallocate(ctx context.Context, name string) error {
 	}
 }
 
+// FunctionCall calls the function with oid using the PostgreSQL fast-path function call protocol. This avoids the
+// parse and plan overhead of executing a query. args are the argument values. They must be encoded in the format given
+// by argFormats. If argFormats is nil all args are text format. FunctionCall returns an error if len(argFormats) is not
+// 0, 1, or len(args). resultFormat is the format of the returned result. A NULL result is returned as nil.
+func (pgConn *PgConn) FunctionCall(ctx context.Context, oid uint32, args [][]byte, argFormats []int16, resultFormat int16) ([]byte, error) {
+	return pgConn.FunctionCallInto(ctx, oid, args, argFormats, resultFormat, nil)
+}
+
+// FunctionCallInto is like FunctionCall but the result is written into buf. The returned result shares the memory of
+// buf if the capacity of buf is large enough. Otherwise a new slice is allocated. This allows large results to be read
+// without allocating for each call.
+func (pgConn *PgConn) FunctionCallInto(ctx context.Context, oid uint32, args [][]byte, argFormats []int16, resultFormat int16, buf []byte) ([]byte, error) {
+	if len(args) > math.MaxUint16 {
+		return nil, fmt.Errorf("function call limited to %v arguments", math.MaxUint16)
+	}
+	if len(argFormats) > 1 && len(argFormats) != len(args) {
+		return nil, fmt.Errorf("expected 0, 1, or %d argument formats, got %d", len(args), len(argFormats))
+	}
+
+	if err := pgConn.lock(); err != nil {
+		return nil, err
+	}
+	defer pgConn.unlock()
+
+	if ctx != context.Background() {
+		select {
+		case <-ctx.Done():
+			return nil, newContextAlreadyDoneError(ctx)
+		default:
+		}
+		pgConn.contextWatcher.Watch(ctx)
+		defer pgConn.contextWatcher.Unwatch()
+	}
+
+	argFormatCodes := make([]uint16, len(argFormats))
+	for i, f := range argFormats {
+		argFormatCodes[i] = uint16(f)
+	}
+
+	pgConn.frontend.Send(&pgproto3.FunctionCall{
+		Function:         oid,
+		ArgFormatCodes:   argFormatCodes,
+		Arguments:        args,
+		ResultFormatCode: uint16(resultFormat),
+	})
+	err := pgConn.flushWithPotentialWriteReadDeadlock()
+	if err != nil {
+		pgConn.asyncClose()
+		return nil, err
+	}
+
+	var result []byte
+	var pgErr error
+	for {
+		msg, err := pgConn.receiveMessage()
+		if err != nil {
+			pgConn.asyncClose()
+			return nil, normalizeTimeoutError(ctx, err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.FunctionCallResponse:
+			if msg.Result != nil {
+				result = append(buf[:0], msg.Result...)
+				if result == nil {
+					// An empty result is not NULL.
+					result = []byte{}
+				}
+			}
+		case *pgproto3.ErrorResponse:
+			pgErr = ErrorResponseToPgError(msg)
+		case *pgproto3.ReadyForQuery:
+			if pgErr != nil {
+				return nil, pgErr
+			}
+			return result, nil
+		}
+	}
+}
+
 // ErrorResponseToPgError converts a wire protocol error message to a *PgError.
 func ErrorResponseToPgError(msg *pgproto3.ErrorResponse) *PgError {
 	return &PgError{
@@ -1016,11 +1282,10 @@ func (pgConn *PgConn) CancelRequest(ctx context.Context) error {
 		defer contextWatcher.Unwatch()
 	}
 
-	buf := make([]byte, 16)
-	binary.BigEndian.PutUint32(buf[0:4], 16)
-	binary.BigEndian.PutUint32(buf[4:8], 80877102)
-	binary.BigEndian.PutUint32(buf[8:12], pgConn.pid)
-	binary.BigEndian.PutUint32(buf[12:16], pgConn.secretKey)
+	buf, err := (&pgproto3.CancelRequest{ProcessID: pgConn.pid, SecretKey: pgConn.secretKey}).Encode(nil)
+	if err != nil {
+		return err
+	}
 
 	if _, err := cancelConn.Write(buf); err != nil {
 		return fmt.Errorf("write to connection for cancellation: %w", err)
@@ -1137,7 +1402,7 @@ func (pgConn *PgConn) ExecParams(ctx context.Context, sql string, paramValues []
 	pgConn.frontend.SendParse(&pgproto3.Parse{Query: sql, ParameterOIDs: paramOIDs})
 	pgConn.frontend.SendBind(&pgproto3.Bind{ParameterFormatCodes: paramFormats, Parameters: paramValues, ResultFormatCodes: resultFormats})
 
-	pgConn.execExtendedSuffix(result)
+	pgConn.execExtendedSuffix(result, "", 0)
 
 	return result
 }
@@ -1162,11 +1427,71 @@ func (pgConn *PgConn) ExecPrepared(ctx context.Context, stmtName string, paramVa
 
 	pgConn.frontend.SendBind(&pgproto3.Bind{PreparedStatement: stmtName, ParameterFormatCodes: paramFormats, Parameters: paramValues, ResultFormatCodes: resultFormats})
 
-	pgConn.execExtendedSuffix(result)
+	pgConn.execExtendedSuffix(result, "", 0)
 
 	return result
 }
 
+// ExecParamsPortal is like ExecParams except that the query is bound to the portal named portalName and at most
+// maxRows rows are returned. If maxRows is 0 all rows are returned. If the portal has more rows, PortalSuspended on
+// the ResultReader returns true after all returned rows are read and FetchPortal can be used to fetch the next rows.
+//
+// Named portals only last until the end of the transaction. ExecParamsPortal should be used in a transaction block
+// because the Sync that ends each round trip also ends an implicit transaction, destroying the portal.
+//
+// ResultReader must be closed before PgConn can be used again.
+func (pgConn *PgConn) ExecParamsPortal(ctx context.Context, portalName string, sql string, paramValues [][]byte, paramOIDs []uint32, paramFormats []int16, resultFormats []int16, maxRows uint32) *ResultReader {
+	result := pgConn.execExtendedPrefix(ctx, paramValues)
+	if result.closed {
+		return result
+	}
+
+	pgConn.frontend.SendParse(&pgproto3.Parse{Query: sql, ParameterOIDs: paramOIDs})
+	pgConn.frontend.SendBind(&pgproto3.Bind{DestinationPortal: portalName, ParameterFormatCodes: paramFormats, Parameters: paramValues, ResultFormatCodes: resultFormats})
+
+	pgConn.execExtendedSuffix(result, portalName, maxRows)
+
+	return result
+}
+
+// ExecPreparedPortal is like ExecPrepared except that the prepared statement is bound to the portal named portalName
+// and at most maxRows rows are returned. See ExecParamsPortal for details.
+//
+// ResultReader must be closed before PgConn can be used again.
+func (pgConn *PgConn) ExecPreparedPortal(ctx context.Context, portalName string, stmtName string, paramValues [][]byte, paramFormats []int16, resultFormats []int16, maxRows uint32) *ResultReader {
+	result := pgConn.execExtendedPrefix(ctx, paramValues)
+	if result.closed {
+		return result
+	}
+
+	pgConn.frontend.SendBind(&pgproto3.Bind{DestinationPortal: portalName, PreparedStatement: stmtName, ParameterFormatCodes: paramFormats, Parameters: paramValues, ResultFormatCodes: resultFormats})
+
+	pgConn.execExtendedSuffix(result, portalName, maxRows)
+
+	return result
+}
+
+// FetchPortal resumes execution of the portal named portalName that was created by ExecParamsPortal or
+// ExecPreparedPortal and returns at most maxRows more rows. If maxRows is 0 all remaining rows are returned.
+// PortalSuspended on the ResultReader reports whether the portal still has more rows.
+//
+// ResultReader must be closed before PgConn can be used again.
+func (pgConn *PgConn) FetchPortal(ctx context.Context, portalName string, maxRows uint32) *ResultReader {
+	result := pgConn.execExtendedPrefix(ctx, nil)
+	if result.closed {
+		return result
+	}
+
+	pgConn.execExtendedSuffix(result, portalName, maxRows)
+
+	return result
+}
+
+// ClosePortal closes the portal named portalName. Closing a non-existent portal is not an error.
+func (pgConn *PgConn) ClosePortal(ctx context.Context, portalName string) error {
+	return pgConn.close(ctx, 'P', portalName)
+}
+
 func (pgConn *PgConn) execExtendedPrefix(ctx context.Context, paramValues [][]byte) *ResultReader {
 	pgConn.resultReader = ResultReader{
 		pgConn: pgConn,
@@ -1202,9 +1527,9 @@ func (pgConn *PgConn) execExtendedPrefix(ctx context.Context, paramValues [][]by
 	return result
 }
 
-func (pgConn *PgConn) execExtendedSuffix(result *ResultReader) {
-	pgConn.frontend.SendDescribe(&pgproto3.Describe{ObjectType: 'P'})
-	pgConn.frontend.SendExecute(&pgproto3.Execute{})
+func (pgConn *PgConn) execExtendedSuffix(result *ResultReader, portalName string, maxRows uint32) {
+	pgConn.frontend.SendDescribe(&pgproto3.Describe{ObjectType: 'P', Name: portalName})
+	pgConn.frontend.SendExecute(&pgproto3.Execute{Portal: portalName, MaxRows: maxRows})
 	pgConn.frontend.SendSync(&pgproto3.Sync{})
 
 	err := pgConn.flushWithPotentialWriteReadDeadlock()
@@ -1519,6 +1844,7 @@ type ResultReader struct {
 	rowValues         [][]byte
 	commandTag        CommandTag
 	commandConcluded  bool
+	portalSuspended   bool
 	closed            bool
 	err               error
 }
@@ -1588,6 +1914,13 @@ func (rr *ResultReader) Values() [][]byte {
 	return rr.rowValues
 }
 
+// PortalSuspended returns true if the execution of the portal stopped because the row limit given to
+// ExecParamsPortal, ExecPreparedPortal, or FetchPortal was reached. The remaining rows can be fetched with FetchPortal.
+// It is only valid after all rows have been read or the ResultReader is closed.
+func (rr *ResultReader) PortalSuspended() bool {
+	return rr.portalSuspended
+}
+
 // Close consumes any remaining result data and returns the command tag or
 // error.
 func (rr *ResultReader) Close() (CommandTag, error) {
@@ -1671,6 +2004,9 @@ func (rr *ResultReader) receiveMessage() (msg pgproto3.BackendMessage, err error
 		rr.concludeCommand(rr.pgConn.makeCommandTag(msg.CommandTag), nil)
 	case *pgproto3.EmptyQueryResponse:
 		rr.concludeCommand(CommandTag{}, nil)
+	case *pgproto3.PortalSuspended:
+		rr.concludeCommand(CommandTag{}, nil)
+		rr.portalSuspended = true
 	case *pgproto3.ErrorResponse:
 		rr.concludeCommand(CommandTag{}, ErrorResponseToPgError(msg))
 	}
@@ -1914,7 +2250,8 @@ func (pgConn *PgConn) CustomData() map[string]any {
 type HijackedConn struct {
 	Conn              net.Conn
 	PID               uint32            // backend pid
-	SecretKey         uint32            // key to use to send a cancel query message to the server
+	SecretKey         []byte            // key to use to send a cancel query message to the server
+	ProtocolVersion   uint32            // negotiated wire protocol version. If 0, pgproto3.ProtocolVersion30 is assumed.
 	ParameterStatuses map[string]string // parameters that have been reported by the server
 	TxStatus          byte
 	Frontend          *pgproto3.Frontend
@@ -1938,6 +2275,7 @@ func (pgConn *PgConn) Hijack() (*HijackedConn, error) {
 		Conn:              pgConn.conn,
 		PID:               pgConn.pid,
 		SecretKey:         pgConn.secretKey,
+		ProtocolVersion:   pgConn.protocolVersion,
 		ParameterStatuses: pgConn.parameterStatuses,
 		TxStatus:          pgConn.txStatus,
 		Frontend:          pgConn.frontend,
@@ -1958,6 +2296,7 @@ func Construct(hc *HijackedConn) (*PgConn, error) {
 		conn:              hc.Conn,
 		pid:               hc.PID,
 		secretKey:         hc.SecretKey,
+		protocolVersion:   hc.ProtocolVersion,
 		parameterStatuses: hc.ParameterStatuses,
 		txStatus:          hc.TxStatus,
 		frontend:          hc.Frontend,
@@ -1969,6 +2308,10 @@ func Construct(hc *HijackedConn) (*PgConn, error) {
 		cleanupDone: make(chan struct{}),
 	}
 
+	if pgConn.protocolVersion == 0 {
+		pgConn.protocolVersion = pgproto3.ProtocolVersion30
+	}
+
 	pgConn.contextWatcher = ctxwatch.NewContextWatcher(hc.Config.BuildContextWatcherHandler(pgConn))
 	pgConn.bgReader = bgreader.New(pgConn.conn)
 	pgConn.slowWriteTimer = time.AfterFunc(time.Duration(math.MaxInt64),
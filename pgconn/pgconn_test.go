@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/md5"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -220,7 +221,7 @@ func TestConnectTimeout(t *testing.T) {
 					pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
 					pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
 					pgmockWaitStep(time.Millisecond * 500),
-					pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: 0}),
+					pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}),
 					pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
 				},
 			}
@@ -339,6 +340,464 @@ func TestConnectTimeoutStuckOnTLSHandshake(t *testing.T) {
 	}
 }
 
+func TestConnectChannelBindingRequireFailsWithoutSCRAM(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	host, port, _ := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connStr := fmt.Sprintf("sslmode=disable channel_binding=require host=%s port=%s", host, port)
+	_, err := pgconn.Connect(ctx, connStr)
+	require.ErrorContains(t, err, "channel binding required")
+}
+
+func TestConnectChannelBindingRequireFailsWithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}}),
+	}}
+	host, port, _ := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connStr := fmt.Sprintf("sslmode=disable channel_binding=require host=%s port=%s", host, port)
+	_, err := pgconn.Connect(ctx, connStr)
+	require.ErrorContains(t, err, "connection is not using TLS")
+}
+
+// setAuthTypeStep is a pgmock.Step that sets the authentication type the backend uses to decode 'p' messages.
+type setAuthTypeStep uint32
+
+func (s setAuthTypeStep) Step(backend *pgproto3.Backend) error {
+	return backend.SetAuthType(uint32(s))
+}
+
+// oauthBearerSteps returns the steps of an OAUTHBEARER exchange where the client sends auth.
+func oauthBearerSteps(auth string) []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"OAUTHBEARER"}}),
+		setAuthTypeStep(pgproto3.AuthTypeSASL),
+		pgmock.ExpectMessage(&pgproto3.SASLInitialResponse{AuthMechanism: "OAUTHBEARER", Data: []byte("n,,\x01auth=" + auth + "\x01\x01")}),
+	}
+}
+
+// oauthBearerRejectSteps returns the steps of the server rejecting an OAUTHBEARER client response.
+func oauthBearerRejectSteps() []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.SendMessage(&pgproto3.AuthenticationSASLContinue{Data: []byte(`{"status":"invalid_token","scope":"openid postgres","openid-configuration":"https://issuer.example.com/.well-known/openid-configuration"}`)}),
+		setAuthTypeStep(pgproto3.AuthTypeSASLContinue),
+		pgmock.ExpectMessage(&pgproto3.SASLResponse{Data: []byte("\x01")}),
+		pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28000", Message: "OAuth bearer authentication failed"}),
+	}
+}
+
+// acceptAuthenticatedConnSteps returns the steps of the server completing a connection after authentication.
+func acceptAuthenticatedConnSteps() []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
+		pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	}
+}
+
+func TestConnectOAuthBearerDiscovery(t *testing.T) {
+	t.Parallel()
+
+	discoveryScript := &pgmock.Script{Steps: append(oauthBearerSteps(""), oauthBearerRejectSteps()...)}
+	tokenScript := &pgmock.Script{Steps: append(oauthBearerSteps("Bearer secret-token"), acceptAuthenticatedConnSteps()...)}
+	host, port, serverErrChan := startMockServerScripts(t, discoveryScript, tokenScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s port=%s user=alice", host, port))
+	require.NoError(t, err)
+
+	var requests []pgconn.OAuthTokenRequest
+	config.OAuthTokenProvider = func(ctx context.Context, req *pgconn.OAuthTokenRequest) (string, error) {
+		requests = append(requests, *req)
+		if req.OpenIDConfiguration == "" {
+			return "", nil
+		}
+		return "secret-token", nil
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+
+	require.Equal(t, []pgconn.OAuthTokenRequest{
+		{Host: host, User: "alice"},
+		{Host: host, User: "alice", OpenIDConfiguration: "https://issuer.example.com/.well-known/openid-configuration", Scope: "openid postgres"},
+	}, requests)
+}
+
+func TestConnectOAuthBearerToken(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: append(oauthBearerSteps("Bearer cached-token"), acceptAuthenticatedConnSteps()...)}
+	host, port, serverErrChan := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	calls := 0
+	config.OAuthTokenProvider = func(ctx context.Context, req *pgconn.OAuthTokenRequest) (string, error) {
+		calls++
+		return "cached-token", nil
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+	require.Equal(t, 1, calls)
+}
+
+func TestConnectOAuthBearerTokenRejected(t *testing.T) {
+	t.Parallel()
+
+	expiredScript := &pgmock.Script{Steps: append(oauthBearerSteps("Bearer expired-token"), oauthBearerRejectSteps()...)}
+	rejectedScript := &pgmock.Script{Steps: append(oauthBearerSteps("Bearer bad-token"), oauthBearerRejectSteps()...)}
+	host, port, serverErrChan := startMockServerScripts(t, expiredScript, rejectedScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	config.OAuthTokenProvider = func(ctx context.Context, req *pgconn.OAuthTokenRequest) (string, error) {
+		if req.OpenIDConfiguration == "" {
+			return "expired-token", nil
+		}
+		return "bad-token", nil
+	}
+
+	_, err = pgconn.ConnectConfig(ctx, config)
+	require.ErrorContains(t, err, "server rejected OAuth bearer token (invalid_token)")
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	require.Equal(t, "28000", pgErr.Code)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestConnectOAuthBearerWithoutTokenProvider(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"OAUTHBEARER"}}),
+	}}
+	host, port, _ := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.ErrorContains(t, err, "no OAuthTokenProvider is configured")
+}
+
+// testSASLMechanism is a SASLMechanism that echoes each server challenge.
+type testSASLMechanism struct {
+	user  string
+	final []byte
+}
+
+func (m *testSASLMechanism) Start() (string, []byte, error) {
+	return "X-TEST", []byte(m.user), nil
+}
+
+func (m *testSASLMechanism) Continue(data []byte) ([]byte, error) {
+	return append([]byte("echo:"), data...), nil
+}
+
+func (m *testSASLMechanism) Final(data []byte) error {
+	m.final = data
+	return nil
+}
+
+func TestConnectRegisteredSASLMechanism(t *testing.T) {
+	t.Parallel()
+
+	var mechanism *testSASLMechanism
+	pgconn.RegisterSASLMechanism("X-TEST", func(ctx context.Context, info *pgconn.SASLAuthInfo) (pgconn.SASLMechanism, error) {
+		mechanism = &testSASLMechanism{user: info.Config.User}
+		return mechanism, nil
+	})
+	t.Cleanup(func() { pgconn.RegisterSASLMechanism("X-TEST", nil) })
+
+	script := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"X-UNKNOWN", "X-TEST", "SCRAM-SHA-256"}}),
+		setAuthTypeStep(pgproto3.AuthTypeSASL),
+		pgmock.ExpectMessage(&pgproto3.SASLInitialResponse{AuthMechanism: "X-TEST", Data: []byte("alice")}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASLContinue{Data: []byte("challenge")}),
+		setAuthTypeStep(pgproto3.AuthTypeSASLContinue),
+		pgmock.ExpectMessage(&pgproto3.SASLResponse{Data: []byte("echo:challenge")}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASLFinal{Data: []byte("done")}),
+	}}
+	script.Steps = append(script.Steps, acceptAuthenticatedConnSteps()...)
+	host, port, serverErrChan := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s user=alice", host, port))
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+	require.Equal(t, []byte("done"), mechanism.final)
+}
+
+func TestConnectSCRAMRequiresServerFinalMessage(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}}),
+		setAuthTypeStep(pgproto3.AuthTypeSASL),
+		pgmock.ExpectAnyMessage(&pgproto3.SASLInitialResponse{}),
+		pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
+	}}
+	host, port, _ := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s password=secret", host, port))
+	require.ErrorContains(t, err, "SCRAM authentication completed before client-final-message was sent")
+}
+
+func TestConnectRegisteredPasswordProvider(t *testing.T) {
+	// Not parallel because the password provider is registered globally.
+
+	var calls []string
+	pgconn.RegisterPasswordProvider(func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		calls = append(calls, fmt.Sprintf("%s:%d %s", host, port, user))
+		return "token-for-" + user, nil
+	})
+	t.Cleanup(func() { pgconn.RegisterPasswordProvider(nil) })
+
+	providerScript := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationCleartextPassword{}),
+		pgmock.ExpectMessage(&pgproto3.PasswordMessage{Password: "token-for-alice"}),
+	}}
+	providerScript.Steps = append(providerScript.Steps, acceptAuthenticatedConnSteps()...)
+	host, port, serverErrChan := startMockServer(t, providerScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s user=alice password=secret", host, port))
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+	require.Equal(t, []string{fmt.Sprintf("%s:%s alice", host, port)}, calls)
+
+	// Config.GetPassword takes precedence over the registered provider.
+	getPasswordScript := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationCleartextPassword{}),
+		pgmock.ExpectMessage(&pgproto3.PasswordMessage{Password: "from-config"}),
+	}}
+	getPasswordScript.Steps = append(getPasswordScript.Steps, acceptAuthenticatedConnSteps()...)
+	host, port, serverErrChan = startMockServer(t, getPasswordScript)
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s port=%s user=alice password=secret", host, port))
+	require.NoError(t, err)
+	config.GetPassword = func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		return "from-config", nil
+	}
+
+	conn, err = pgconn.ConnectConfig(ctx, config)
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+	require.Len(t, calls, 1)
+}
+
+func TestConnectGetPassword(t *testing.T) {
+	t.Parallel()
+
+	unavailableScript := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationCleartextPassword{}),
+		pgmock.ExpectMessage(&pgproto3.PasswordMessage{Password: "password-1"}),
+		pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "57P03", Message: "the database system is starting up"}),
+	}}
+	host1, port1, serverErrChan1 := startMockServer(t, unavailableScript)
+
+	hexMD5 := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+	availableScript := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationMD5Password{Salt: [4]byte{1, 2, 3, 4}}),
+		pgmock.ExpectMessage(&pgproto3.PasswordMessage{Password: "md5" + hexMD5(hexMD5("password-2"+"alice")+"\x01\x02\x03\x04")}),
+	}}
+	availableScript.Steps = append(availableScript.Steps, acceptAuthenticatedConnSteps()...)
+	host2, port2, serverErrChan2 := startMockServer(t, availableScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s,%s port=%s,%s user=alice password=static", host1, host2, port1, port2))
+	require.NoError(t, err)
+
+	var calls []string
+	config.GetPassword = func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		calls = append(calls, fmt.Sprintf("%s:%d %s", host, port, user))
+		return fmt.Sprintf("password-%d", len(calls)), nil
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	require.NoError(t, err)
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan1)
+	require.NoError(t, <-serverErrChan2)
+
+	require.Equal(t, []string{
+		fmt.Sprintf("%s:%s alice", host1, port1),
+		fmt.Sprintf("%s:%s alice", host2, port2),
+	}, calls)
+}
+
+func TestConnectGetPasswordError(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}}),
+	}}
+	host, port, _ := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config, err := pgconn.ParseConfig(fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	vaultErr := errors.New("vault unavailable")
+	config.GetPassword = func(ctx context.Context, host string, port uint16, user string) (string, error) {
+		return "", vaultErr
+	}
+
+	_, err = pgconn.ConnectConfig(ctx, config)
+	require.ErrorIs(t, err, vaultErr)
+}
+
+// expectStartupProtocolVersionStep is a pgmock.Step that expects a StartupMessage requesting protocolVersion.
+type expectStartupProtocolVersionStep struct {
+	protocolVersion uint32
+}
+
+func (e *expectStartupProtocolVersionStep) Step(backend *pgproto3.Backend) error {
+	msg, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return err
+	}
+
+	startupMsg, ok := msg.(*pgproto3.StartupMessage)
+	if !ok {
+		return fmt.Errorf("expected StartupMessage, got %T", msg)
+	}
+	if startupMsg.ProtocolVersion != e.protocolVersion {
+		return fmt.Errorf("expected protocol version %d, got %d", e.protocolVersion, startupMsg.ProtocolVersion)
+	}
+
+	return nil
+}
+
+func TestConnectProtocolVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name            string
+		connParams      string
+		steps           []pgmock.Step
+		protocolVersion uint32
+		expectErr       string
+	}{
+		{
+			name:            "default",
+			connParams:      "",
+			steps:           []pgmock.Step{&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion30}},
+			protocolVersion: pgproto3.ProtocolVersion30,
+		},
+		{
+			name:            "3.2 supported",
+			connParams:      "max_protocol_version=3.2",
+			steps:           []pgmock.Step{&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion32}},
+			protocolVersion: pgproto3.ProtocolVersion32,
+		},
+		{
+			name:       "3.2 negotiated down",
+			connParams: "max_protocol_version=latest",
+			steps: []pgmock.Step{
+				&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion32},
+				pgmock.SendMessage(&pgproto3.NegotiateProtocolVersion{NewestMinorProtocol: 0}),
+			},
+			protocolVersion: pgproto3.ProtocolVersion30,
+		},
+		{
+			name:       "below min_protocol_version",
+			connParams: "min_protocol_version=3.2 max_protocol_version=3.2",
+			steps: []pgmock.Step{
+				&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion32},
+				pgmock.SendMessage(&pgproto3.NegotiateProtocolVersion{NewestMinorProtocol: 0}),
+			},
+			expectErr: "server only supports protocol version 3.0",
+		},
+		{
+			name:       "unrecognized options",
+			connParams: "max_protocol_version=3.2",
+			steps: []pgmock.Step{
+				&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion32},
+				pgmock.SendMessage(&pgproto3.NegotiateProtocolVersion{NewestMinorProtocol: 0, UnrecognizedOptions: []string{"_pq_.foo"}}),
+			},
+			expectErr: "did not recognize protocol options",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			script := &pgmock.Script{Steps: tt.steps}
+			if tt.expectErr == "" {
+				script.Steps = append(script.Steps, pgmock.AcceptUnauthenticatedConnRequestSteps()[1:]...)
+				script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+			}
+			host, port, serverErrChan := startMockServer(t, script)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			connStr := fmt.Sprintf("sslmode=disable host=%s port=%s %s", host, port, tt.connParams)
+			conn, err := pgconn.Connect(ctx, connStr)
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.protocolVersion, conn.ProtocolVersion())
+
+			require.NoError(t, conn.Close(ctx))
+			require.NoError(t, <-serverErrChan)
+		})
+	}
+}
+
 func TestConnectInvalidUser(t *testing.T) {
 	t.Parallel()
 
@@ -462,6 +921,54 @@ func TestConnectCustomLookupWithPort(t *testing.T) {
 	closeConn(t, conn)
 }
 
+func TestConnectLoadBalanceHosts(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialOrder := func(connString string) []string {
+		config, err := pgconn.ParseConfig(connString)
+		require.NoError(t, err)
+
+		config.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			return []string{host + "1", host + "2"}, nil
+		}
+		var addresses []string
+		config.DialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(address)
+			addresses = append(addresses, host)
+			return nil, errors.New("dial failed")
+		}
+
+		_, err = pgconn.ConnectConfig(ctx, config)
+		require.Error(t, err)
+		return addresses
+	}
+
+	assert.Equal(t, []string{"a1", "a2", "b1", "b2"}, dialOrder("host=a,b sslmode=disable"))
+	assert.Equal(t, []string{"a1", "a2", "b1", "b2"}, dialOrder("host=a,b sslmode=disable load_balance_hosts=disable"))
+
+	firstSeen := map[string]struct{}{}
+	for i := 0; i < 1000 && len(firstSeen) < 4; i++ {
+		addresses := dialOrder("host=a,b sslmode=disable load_balance_hosts=random")
+		require.ElementsMatch(t, []string{"a1", "a2", "b1", "b2"}, addresses)
+		// Addresses of the same host are tried together.
+		require.Equal(t, addresses[0][0], addresses[1][0])
+		firstSeen[addresses[0]] = struct{}{}
+	}
+	assert.Len(t, firstSeen, 4, "every address should eventually be tried first")
+
+	// The TLS and non-TLS attempts for each host stay together with sslmode=prefer.
+	for i := 0; i < 10; i++ {
+		addresses := dialOrder("host=a,b sslmode=prefer load_balance_hosts=random")
+		require.Len(t, addresses, 8)
+		for _, address := range addresses[1:4] {
+			require.Equal(t, addresses[0][0], address[0])
+		}
+	}
+}
+
 func TestConnectWithRuntimeParams(t *testing.T) {
 	t.Parallel()
 
@@ -2452,6 +2959,254 @@ func testConnContextCanceledCancelsRunningQueryOnServer(t *testing.T, connString
 	}
 }
 
+func TestConnExecPortal(t *testing.T) {
+	t.Parallel()
+
+	rowDescription := &pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("n"), DataTypeOID: 23, DataTypeSize: 4, TypeModifier: -1}}}
+
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	script.Steps = append(script.Steps,
+		pgmock.ExpectMessage(&pgproto3.Bind{DestinationPortal: "p", PreparedStatement: "s", ResultFormatCodes: []int16{}}),
+		pgmock.ExpectMessage(&pgproto3.Describe{ObjectType: 'P', Name: "p"}),
+		pgmock.ExpectMessage(&pgproto3.Execute{Portal: "p", MaxRows: 2}),
+		pgmock.ExpectMessage(&pgproto3.Sync{}),
+		pgmock.SendMessage(&pgproto3.BindComplete{}),
+		pgmock.SendMessage(rowDescription),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("1")}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("2")}}),
+		pgmock.SendMessage(&pgproto3.PortalSuspended{}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+
+		pgmock.ExpectMessage(&pgproto3.Describe{ObjectType: 'P', Name: "p"}),
+		pgmock.ExpectMessage(&pgproto3.Execute{Portal: "p", MaxRows: 2}),
+		pgmock.ExpectMessage(&pgproto3.Sync{}),
+		pgmock.SendMessage(rowDescription),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("3")}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+
+		pgmock.ExpectMessage(&pgproto3.Close{ObjectType: 'P', Name: "p"}),
+		pgmock.ExpectMessage(&pgproto3.Sync{}),
+		pgmock.SendMessage(&pgproto3.CloseComplete{}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+		pgmock.ExpectMessage(&pgproto3.Terminate{}),
+	)
+
+	host, port, serverErrChan := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pgConn, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	rr := pgConn.ExecPreparedPortal(ctx, "p", "s", nil, nil, nil, 2)
+	result := rr.Read()
+	require.NoError(t, result.Err)
+	assert.Equal(t, [][][]byte{{[]byte("1")}, {[]byte("2")}}, result.Rows)
+	assert.True(t, rr.PortalSuspended())
+
+	rr = pgConn.FetchPortal(ctx, "p", 2)
+	result = rr.Read()
+	require.NoError(t, result.Err)
+	assert.Equal(t, "n", result.FieldDescriptions[0].Name)
+	assert.Equal(t, [][][]byte{{[]byte("3")}}, result.Rows)
+	assert.Equal(t, "SELECT 1", result.CommandTag.String())
+	assert.False(t, rr.PortalSuspended())
+
+	err = pgConn.ClosePortal(ctx, "p")
+	require.NoError(t, err)
+
+	require.NoError(t, pgConn.Close(ctx))
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestConnFunctionCall(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	script.Steps = append(script.Steps,
+		pgmock.ExpectMessage(&pgproto3.FunctionCall{
+			Function:         954,
+			ArgFormatCodes:   []uint16{1},
+			Arguments:        [][]byte{{0, 0, 0, 1}, {0, 0, 0, 5}},
+			ResultFormatCode: 1,
+		}),
+		pgmock.SendMessage(&pgproto3.FunctionCallResponse{Result: []byte("hello")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'T'}),
+
+		pgmock.ExpectMessage(&pgproto3.FunctionCall{
+			Function:         955,
+			ArgFormatCodes:   []uint16{},
+			Arguments:        [][]byte{[]byte("1"), nil},
+			ResultFormatCode: 0,
+		}),
+		pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42883", Message: "function does not exist"}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'E'}),
+		pgmock.ExpectMessage(&pgproto3.Terminate{}),
+	)
+
+	host, port, serverErrChan := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pgConn, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	result, err := pgConn.FunctionCall(ctx, 954, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 5}}, []int16{pgx.BinaryFormatCode}, pgx.BinaryFormatCode)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), result)
+
+	_, err = pgConn.FunctionCall(ctx, 955, [][]byte{[]byte("1"), nil}, nil, pgx.TextFormatCode)
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "42883", pgErr.Code)
+	assert.Equal(t, byte('E'), pgConn.TxStatus())
+
+	_, err = pgConn.FunctionCall(ctx, 955, [][]byte{nil, nil, nil}, []int16{0, 1}, pgx.TextFormatCode)
+	require.Error(t, err)
+
+	require.NoError(t, pgConn.Close(ctx))
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestConnFunctionCallInto(t *testing.T) {
+	t.Parallel()
+
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	for _, result := range [][]byte{[]byte("hello"), []byte("hello world"), {}, nil} {
+		script.Steps = append(script.Steps,
+			pgmock.ExpectAnyMessage(&pgproto3.FunctionCall{}),
+			pgmock.SendMessage(&pgproto3.FunctionCallResponse{Result: result}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		)
+	}
+	script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+
+	host, port, serverErrChan := startMockServer(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pgConn, err := pgconn.Connect(ctx, fmt.Sprintf("sslmode=disable host=%s port=%s", host, port))
+	require.NoError(t, err)
+
+	// The result is written into buf when it fits.
+	buf := make([]byte, 8)
+	result, err := pgConn.FunctionCallInto(ctx, 954, nil, nil, pgx.BinaryFormatCode, buf[:0])
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), result)
+	assert.Equal(t, []byte("hello"), buf[:5])
+
+	// A result that does not fit is allocated and buf is not written past its capacity.
+	result, err = pgConn.FunctionCallInto(ctx, 954, nil, nil, pgx.BinaryFormatCode, buf[:0:4])
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello world"), result)
+	assert.Equal(t, []byte("hello"), buf[:5])
+
+	result, err = pgConn.FunctionCallInto(ctx, 954, nil, nil, pgx.BinaryFormatCode, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Empty(t, result)
+
+	result, err = pgConn.FunctionCallInto(ctx, 954, nil, nil, pgx.BinaryFormatCode, buf)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	require.NoError(t, pgConn.Close(ctx))
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestConnCancelRequestLongSecretKey(t *testing.T) {
+	t.Parallel()
+
+	secretKey := make([]byte, 32)
+	for i := range secretKey {
+		secretKey[i] = byte(i)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverErrChan := make(chan error, 1)
+	cancelRequestChan := make(chan *pgproto3.CancelRequest, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+		defer conn.Close()
+
+		script := &pgmock.Script{Steps: []pgmock.Step{
+			&expectStartupProtocolVersionStep{protocolVersion: pgproto3.ProtocolVersion32},
+			pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
+			pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 42, SecretKey: secretKey}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		}}
+		err = script.Run(pgproto3.NewBackend(conn, conn))
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+
+		cancelConn, err := ln.Accept()
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+		defer cancelConn.Close()
+
+		msg, err := pgproto3.NewBackend(cancelConn, cancelConn).ReceiveStartupMessage()
+		if err != nil {
+			serverErrChan <- err
+			return
+		}
+		cancelRequest, ok := msg.(*pgproto3.CancelRequest)
+		if !ok {
+			serverErrChan <- fmt.Errorf("expected CancelRequest, got %T", msg)
+			return
+		}
+		cancelRequestChan <- &pgproto3.CancelRequest{ProcessID: cancelRequest.ProcessID, SecretKey: bytes.Clone(cancelRequest.SecretKey)}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	connStr := fmt.Sprintf("sslmode=disable host=%s port=%s max_protocol_version=3.2", host, port)
+	pgConn, err := pgconn.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer pgConn.Close(ctx)
+
+	assert.Equal(t, uint32(42), pgConn.PID())
+	assert.Equal(t, secretKey, pgConn.SecretKey())
+
+	err = pgConn.CancelRequest(ctx)
+	require.NoError(t, err)
+
+	select {
+	case cancelRequest := <-cancelRequestChan:
+		assert.Equal(t, uint32(42), cancelRequest.ProcessID)
+		assert.Equal(t, secretKey, cancelRequest.SecretKey)
+	case err := <-serverErrChan:
+		t.Fatalf("server failed with error: %v", err)
+	}
+
+	hc, err := pgConn.Hijack()
+	require.NoError(t, err)
+	assert.Equal(t, secretKey, hc.SecretKey)
+	assert.Equal(t, uint32(pgproto3.ProtocolVersion32), hc.ProtocolVersion)
+
+	constructedConn, err := pgconn.Construct(hc)
+	require.NoError(t, err)
+	assert.Equal(t, secretKey, constructedConn.SecretKey())
+	assert.Equal(t, uint32(pgproto3.ProtocolVersion32), constructedConn.ProtocolVersion())
+	constructedConn.Conn().Close()
+}
+
 func TestHijackAndConstruct(t *testing.T) {
 	t.Parallel()
 
@@ -3414,7 +4169,7 @@ func TestSNISupport(t *testing.T) {
 				}
 
 				srv.Write(mustEncode((&pgproto3.AuthenticationOk{}).Encode(nil)))
-				srv.Write(mustEncode((&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: 0}).Encode(nil)))
+				srv.Write(mustEncode((&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}).Encode(nil)))
 				srv.Write(mustEncode((&pgproto3.ReadyForQuery{TxStatus: 'I'}).Encode(nil)))
 
 				serverSNINameChan <- sniHost
@@ -3440,6 +4195,90 @@ func TestSNISupport(t *testing.T) {
 	}
 }
 
+func TestConnectDirectTLS(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name       string
+		serverALPN []string
+		expectErr  string
+	}{
+		{name: "ALPN selected", serverALPN: []string{"postgresql"}},
+		{name: "ALPN not selected", serverALPN: nil, expectErr: "did not select ALPN protocol"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:")
+			require.NoError(t, err)
+			defer ln.Close()
+
+			serverErrChan := make(chan error, 1)
+			go func() {
+				defer close(serverErrChan)
+
+				conn, err := ln.Accept()
+				if err != nil {
+					serverErrChan <- err
+					return
+				}
+				defer conn.Close()
+
+				err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if err != nil {
+					serverErrChan <- err
+					return
+				}
+
+				cert, err := tls.X509KeyPair([]byte(rsaCertPEM), []byte(rsaKeyPEM))
+				if err != nil {
+					serverErrChan <- err
+					return
+				}
+
+				// The TLS handshake must be the first thing sent by the client.
+				srv := tls.Server(conn, &tls.Config{
+					Certificates: []tls.Certificate{cert},
+					NextProtos:   tt.serverALPN,
+				})
+				defer srv.Close()
+
+				if err := srv.Handshake(); err != nil {
+					serverErrChan <- fmt.Errorf("handshake: %w", err)
+					return
+				}
+
+				script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+				script.Steps = append(script.Steps, pgmock.ExpectMessage(&pgproto3.Terminate{}))
+				err = script.Run(pgproto3.NewBackend(srv, srv))
+				if err != nil && tt.expectErr == "" {
+					serverErrChan <- err
+				}
+			}()
+
+			_, port, _ := strings.Cut(ln.Addr().String(), ":")
+			connStr := fmt.Sprintf("sslmode=require sslnegotiation=direct host=127.0.0.1 port=%s", port)
+			conn, err := pgconn.Connect(ctx, connStr)
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+
+			tlsConn, ok := conn.Conn().(*tls.Conn)
+			require.True(t, ok)
+			assert.Equal(t, "postgresql", tlsConn.ConnectionState().NegotiatedProtocol)
+
+			require.NoError(t, conn.Close(ctx))
+			require.NoError(t, <-serverErrChan)
+		})
+	}
+}
+
 // https://github.com/jackc/pgx/issues/1920
 func TestFatalErrorReceivedInPipelineMode(t *testing.T) {
 	t.Parallel()
@@ -0,0 +1,186 @@
+//go:build ignore
+
+// gen.go generates codes.go from errcodes.txt.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type class struct {
+	code        string
+	description string
+	conditions  []condition
+}
+
+type condition struct {
+	code string
+	name string
+}
+
+var sectionRegexp = regexp.MustCompile(`^Section: Class (\w\w) - ([^(]+)`)
+
+// initialisms are the words of condition names that are not simply capitalized.
+var initialisms = map[string]string{
+	"fdw":           "FDW",
+	"io":            "IO",
+	"json":          "JSON",
+	"plpgsql":       "PLpgSQL",
+	"sql":           "SQL",
+	"sqlclient":     "SQLClient",
+	"sqlconnection": "SQLConnection",
+	"sqlserver":     "SQLServer",
+	"sqlstate":      "SQLState",
+	"srf":           "SRF",
+	"xml":           "XML",
+	"xquery":        "XQuery",
+}
+
+func main() {
+	classes, err := parse("errcodes.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(classes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile("codes.go", src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parse(path string) ([]*class, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var classes []*class
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "Section:") {
+			match := sectionRegexp.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("invalid section: %s", line)
+			}
+			classes = append(classes, &class{code: match[1], description: strings.TrimSpace(match[2])})
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || len(fields[0]) != 5 {
+			return nil, fmt.Errorf("invalid code: %s", line)
+		}
+		if len(classes) == 0 || !strings.HasPrefix(fields[0], classes[len(classes)-1].code) {
+			return nil, fmt.Errorf("code outside of its class section: %s", line)
+		}
+		c := classes[len(classes)-1]
+		c.conditions = append(c.conditions, condition{code: fields[0], name: fields[2]})
+	}
+
+	return classes, scanner.Err()
+}
+
+func generate(classes []*class) ([]byte, error) {
+	// Condition names that are used in more than one class are qualified by the class.
+	nameCount := make(map[string]int)
+	for _, c := range classes {
+		for _, cond := range c.conditions {
+			nameCount[cond.name]++
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprint(buf, "// Code generated by gen.go from errcodes.txt. DO NOT EDIT.\n\n")
+	fmt.Fprint(buf, "package sqlstate\n\n")
+
+	fmt.Fprint(buf, "// SQLSTATE classes.\nconst (\n")
+	for _, c := range classes {
+		fmt.Fprintf(buf, "Class%s = %q // %s\n", className(c.description), c.code, c.description)
+	}
+	fmt.Fprint(buf, ")\n\n")
+
+	fmt.Fprint(buf, "// SQLSTATE codes.\nconst (\n")
+	for i, c := range classes {
+		if i > 0 {
+			fmt.Fprint(buf, "\n")
+		}
+		fmt.Fprintf(buf, "// Class %s - %s\n", c.code, c.description)
+		for _, cond := range c.conditions {
+			name := conditionName(cond.name)
+			if nameCount[cond.name] > 1 {
+				name += className(c.description)
+			}
+			fmt.Fprintf(buf, "%s = %q\n", name, cond.code)
+		}
+	}
+	fmt.Fprint(buf, ")\n\n")
+
+	fmt.Fprint(buf, "var classDescriptions = map[string]string{\n")
+	for _, c := range classes {
+		fmt.Fprintf(buf, "%q: %q,\n", c.code, c.description)
+	}
+	fmt.Fprint(buf, "}\n\n")
+
+	fmt.Fprint(buf, "var conditionNames = map[string]string{\n")
+	for _, c := range classes {
+		for _, cond := range c.conditions {
+			fmt.Fprintf(buf, "%q: %q,\n", cond.code, cond.name)
+		}
+	}
+	fmt.Fprint(buf, "}\n")
+
+	return format.Source(buf.Bytes())
+}
+
+// conditionName converts a condition name such as unique_violation to a Go name such as UniqueViolation.
+func conditionName(s string) string {
+	sb := &strings.Builder{}
+	for _, word := range strings.Split(s, "_") {
+		if initialism, ok := initialisms[word]; ok {
+			sb.WriteString(initialism)
+		} else {
+			sb.WriteString(capitalize(word))
+		}
+	}
+	return sb.String()
+}
+
+// className converts a class description such as "WITH CHECK OPTION Violation" to a Go name such as
+// WithCheckOptionViolation.
+func className(s string) string {
+	sb := &strings.Builder{}
+	for _, word := range strings.Fields(s) {
+		word = strings.ReplaceAll(word, "/", "")
+		if word != "SQL" && strings.ToUpper(word) == word {
+			word = strings.ToLower(word)
+		}
+		sb.WriteString(capitalize(word))
+	}
+	return sb.String()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return string(unicode.ToUpper(rune(s[0]))) + s[1:]
+}
@@ -0,0 +1,31 @@
+// Package sqlstate contains the SQLSTATE error codes reported by PostgreSQL.
+//
+// Each code is a constant named after its condition name. e.g. UniqueViolation is "23505". A condition name that is
+// used in more than one class is suffixed with the class. e.g. StringDataRightTruncationWarning and
+// StringDataRightTruncationDataException. The first two characters of a code are its class. Each class is a constant
+// prefixed with Class. e.g. ClassIntegrityConstraintViolation is "23".
+//
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html.
+package sqlstate
+
+//go:generate go run gen.go
+
+// Class returns the class of code. It is the first two characters of code.
+func Class(code string) string {
+	if len(code) < 2 {
+		return ""
+	}
+	return code[:2]
+}
+
+// ClassDescription returns the description of class. e.g. "Integrity Constraint Violation" for "23". It returns an
+// empty string if class is unknown.
+func ClassDescription(class string) string {
+	return classDescriptions[class]
+}
+
+// ConditionName returns the PL/pgSQL condition name of code. e.g. "unique_violation" for "23505". It returns an empty
+// string if code is unknown.
+func ConditionName(code string) string {
+	return conditionNames[code]
+}
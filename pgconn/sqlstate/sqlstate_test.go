@@ -0,0 +1,28 @@
+package sqlstate_test
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn/sqlstate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClass(t *testing.T) {
+	assert.Equal(t, sqlstate.ClassIntegrityConstraintViolation, sqlstate.Class(sqlstate.UniqueViolation))
+	assert.Equal(t, sqlstate.ClassTransactionRollback, sqlstate.Class(sqlstate.DeadlockDetected))
+	assert.Equal(t, "", sqlstate.Class("4"))
+}
+
+func TestClassDescription(t *testing.T) {
+	assert.Equal(t, "Integrity Constraint Violation", sqlstate.ClassDescription("23"))
+	assert.Equal(t, "System Error", sqlstate.ClassDescription(sqlstate.ClassSystemError))
+	assert.Equal(t, "", sqlstate.ClassDescription("ZZ"))
+}
+
+func TestConditionName(t *testing.T) {
+	assert.Equal(t, "unique_violation", sqlstate.ConditionName("23505"))
+	assert.Equal(t, "serialization_failure", sqlstate.ConditionName(sqlstate.SerializationFailure))
+	assert.Equal(t, "string_data_right_truncation", sqlstate.ConditionName(sqlstate.StringDataRightTruncationWarning))
+	assert.Equal(t, "string_data_right_truncation", sqlstate.ConditionName(sqlstate.StringDataRightTruncationDataException))
+	assert.Equal(t, "", sqlstate.ConditionName("ZZZZZ"))
+}
@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package pgconn
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeout is TCP_USER_TIMEOUT from linux/tcp.h. It is not defined by the syscall package.
+const tcpUserTimeout = 0x12
+
+// defaultKeepalivePeriod matches the keepalive period net.Dialer uses when KeepAlive is zero.
+const defaultKeepalivePeriod = 15 * time.Second
+
+// setTCPControl installs a Control function on d that sets the TCP keepalive options and TCP_USER_TIMEOUT of config
+// on the socket. net.Dialer can only set the keepalive idle time and interval to the same value, so when the interval
+// or count is configured the keepalive handling of net.Dialer is disabled and all keepalive options are set directly.
+func setTCPControl(d *net.Dialer, config *Config) {
+	setKeepalive := config.Keepalives && (config.KeepalivesInterval > 0 || config.KeepalivesCount > 0)
+	userTimeout := config.TCPUserTimeout
+	if !setKeepalive && userTimeout == 0 {
+		return
+	}
+
+	idle := config.KeepalivesIdle
+	if idle == 0 {
+		idle = defaultKeepalivePeriod
+	}
+	interval := config.KeepalivesInterval
+	if interval == 0 {
+		interval = defaultKeepalivePeriod
+	}
+	count := config.KeepalivesCount
+
+	if setKeepalive {
+		d.KeepAlive = -1
+	}
+
+	d.Control = func(network, address string, c syscall.RawConn) error {
+		if !strings.HasPrefix(network, "tcp") {
+			return nil
+		}
+
+		var sockoptErr error
+		err := c.Control(func(fd uintptr) {
+			setsockopt := func(level, opt, value int) {
+				if sockoptErr == nil {
+					sockoptErr = os.NewSyscallError("setsockopt", syscall.SetsockoptInt(int(fd), level, opt, value))
+				}
+			}
+
+			if setKeepalive {
+				setsockopt(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1)
+				setsockopt(syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, roundDurationUp(idle, time.Second))
+				setsockopt(syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, roundDurationUp(interval, time.Second))
+				if count > 0 {
+					setsockopt(syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+				}
+			}
+			if userTimeout > 0 {
+				setsockopt(syscall.IPPROTO_TCP, tcpUserTimeout, roundDurationUp(userTimeout, time.Millisecond))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockoptErr
+	}
+}
+
+func roundDurationUp(d, unit time.Duration) int {
+	return int((d + unit - 1) / unit)
+}
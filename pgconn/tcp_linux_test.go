@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+package pgconn_test
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTCPSockopts(t *testing.T, conn net.Conn, opts map[string][2]int) map[string]int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+
+	values := make(map[string]int, len(opts))
+	var sockoptErr error
+	err = rawConn.Control(func(fd uintptr) {
+		for name, opt := range opts {
+			value, err := syscall.GetsockoptInt(int(fd), opt[0], opt[1])
+			if err != nil {
+				sockoptErr = err
+				return
+			}
+			values[name] = value
+		}
+	})
+	require.NoError(t, err)
+	require.NoError(t, sockoptErr)
+	return values
+}
+
+func TestDialFuncAppliesTCPSettings(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	opts := map[string][2]int{
+		"keepalive":    {syscall.SOL_SOCKET, syscall.SO_KEEPALIVE},
+		"idle":         {syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE},
+		"interval":     {syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL},
+		"count":        {syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT},
+		"user_timeout": {syscall.IPPROTO_TCP, 0x12}, // TCP_USER_TIMEOUT
+	}
+
+	dial := func(connString string) map[string]int {
+		config, err := pgconn.ParseConfig(connString)
+		require.NoError(t, err)
+		conn, err := config.DialFunc(context.Background(), "tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		return getTCPSockopts(t, conn, opts)
+	}
+
+	values := dial("keepalives_idle=7 keepalives_interval=3 keepalives_count=4 tcp_user_timeout=9000")
+	assert.Equal(t, 1, values["keepalive"])
+	assert.Equal(t, 7, values["idle"])
+	assert.Equal(t, 3, values["interval"])
+	assert.Equal(t, 4, values["count"])
+	assert.Equal(t, 9000, values["user_timeout"])
+
+	values = dial("keepalives_idle=20")
+	assert.Equal(t, 1, values["keepalive"])
+	assert.Equal(t, 20, values["idle"])
+	assert.Equal(t, 0, values["user_timeout"])
+
+	values = dial("keepalives=0 tcp_user_timeout=500")
+	assert.Equal(t, 0, values["keepalive"])
+	assert.Equal(t, 500, values["user_timeout"])
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package pgconn
+
+import "net"
+
+// setTCPControl is a no-op on platforms other than Linux. Only Keepalives and KeepalivesIdle are applied, through the
+// KeepAlive field of net.Dialer.
+func setTCPControl(d *net.Dialer, config *Config) {}
@@ -137,12 +137,6 @@ func (b *Backend) ReceiveStartupMessage() (FrontendMessage, error) {
 	code := binary.BigEndian.Uint32(buf)
 
 	switch code {
-	case ProtocolVersionNumber:
-		err = b.startupMessage.Decode(buf)
-		if err != nil {
-			return nil, err
-		}
-		return &b.startupMessage, nil
 	case sslRequestNumber:
 		err = b.sslRequest.Decode(buf)
 		if err != nil {
@@ -162,6 +156,15 @@ func (b *Backend) ReceiveStartupMessage() (FrontendMessage, error) {
 		}
 		return &b.gssEncRequest, nil
 	default:
+		// Any minor version of protocol 3 is a StartupMessage. The server responds with NegotiateProtocolVersion if it does
+		// not support the requested minor version.
+		if code>>16 == ProtocolVersionNumber>>16 {
+			err = b.startupMessage.Decode(buf)
+			if err != nil {
+				return nil, err
+			}
+			return &b.startupMessage, nil
+		}
 		return nil, fmt.Errorf("unknown startup message code: %d", code)
 	}
 }
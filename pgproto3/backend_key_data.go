@@ -2,14 +2,20 @@ package pgproto3
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 
 	"github.com/jackc/pgx/v5/internal/pgio"
 )
 
+// maxSecretKeyLen is the maximum length of the secret key in BackendKeyData and CancelRequest. Protocol 3.0 always uses
+// 4 byte keys. Protocol 3.2 allows keys of up to 256 bytes.
+const maxSecretKeyLen = 256
+
 type BackendKeyData struct {
 	ProcessID uint32
-	SecretKey uint32
+	SecretKey []byte // 4 bytes for protocol 3.0, up to 256 bytes for protocol 3.2. It references the decoded message.
 }
 
 // Backend identifies this message as sendable by the PostgreSQL backend.
@@ -18,12 +24,12 @@ func (*BackendKeyData) Backend() {}
 // Decode decodes src into dst. src must contain the complete message with the exception of the initial 1 byte message
 // type identifier and 4 byte message length.
 func (dst *BackendKeyData) Decode(src []byte) error {
-	if len(src) != 8 {
+	if len(src) < 8 || len(src) > 4+maxSecretKeyLen {
 		return &invalidMessageLenErr{messageType: "BackendKeyData", expectedLen: 8, actualLen: len(src)}
 	}
 
 	dst.ProcessID = binary.BigEndian.Uint32(src[:4])
-	dst.SecretKey = binary.BigEndian.Uint32(src[4:])
+	dst.SecretKey = src[4:]
 
 	return nil
 }
@@ -32,7 +38,7 @@ func (dst *BackendKeyData) Decode(src []byte) error {
 func (src *BackendKeyData) Encode(dst []byte) ([]byte, error) {
 	dst, sp := beginMessage(dst, 'K')
 	dst = pgio.AppendUint32(dst, src.ProcessID)
-	dst = pgio.AppendUint32(dst, src.SecretKey)
+	dst = append(dst, src.SecretKey...)
 	return finishMessage(dst, sp)
 }
 
@@ -41,10 +47,54 @@ func (src BackendKeyData) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Type      string
 		ProcessID uint32
-		SecretKey uint32
+		SecretKey string
 	}{
 		Type:      "BackendKeyData",
 		ProcessID: src.ProcessID,
-		SecretKey: src.SecretKey,
+		SecretKey: hex.EncodeToString(src.SecretKey),
 	})
 }
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (dst *BackendKeyData) UnmarshalJSON(data []byte) error {
+	// Ignore null, like in the main JSON package.
+	if string(data) == "null" {
+		return nil
+	}
+
+	var msg struct {
+		ProcessID uint32
+		SecretKey json.RawMessage
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	secretKey, err := unmarshalSecretKeyJSON(msg.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	dst.ProcessID = msg.ProcessID
+	dst.SecretKey = secretKey
+	return nil
+}
+
+// unmarshalSecretKeyJSON decodes a secret key that is either a hex encoded string or, for compatibility with the JSON
+// of 4 byte keys before variable length keys were supported, a number.
+func unmarshalSecretKeyJSON(data json.RawMessage) ([]byte, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var n uint32
+	if err := json.Unmarshal(data, &n); err == nil {
+		return binary.BigEndian.AppendUint32(nil, n), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid SecretKey: %w", err)
+	}
+	return hex.DecodeString(s)
+}
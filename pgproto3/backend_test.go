@@ -84,6 +84,26 @@ func TestStartupMessage(t *testing.T) {
 		require.Equal(t, want, msg)
 	})
 
+	t.Run("protocol version 3.2", func(t *testing.T) {
+		want := &pgproto3.StartupMessage{
+			ProtocolVersion: pgproto3.ProtocolVersion32,
+			Parameters: map[string]string{
+				"username": "tester",
+			},
+		}
+		dst, err := want.Encode([]byte{})
+		require.NoError(t, err)
+
+		server := &interruptReader{}
+		server.push(dst)
+
+		backend := pgproto3.NewBackend(server, nil)
+
+		msg, err := backend.ReceiveStartupMessage()
+		require.NoError(t, err)
+		require.Equal(t, want, msg)
+	})
+
 	t.Run("invalid packet length", func(t *testing.T) {
 		wantErr := "invalid length of startup packet"
 		tests := []struct {
@@ -2,6 +2,7 @@ package pgproto3
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 
@@ -12,14 +13,14 @@ const cancelRequestCode = 80877102
 
 type CancelRequest struct {
 	ProcessID uint32
-	SecretKey uint32
+	SecretKey []byte // 4 bytes for protocol 3.0, up to 256 bytes for protocol 3.2. It references the decoded message.
 }
 
 // Frontend identifies this message as sendable by a PostgreSQL frontend.
 func (*CancelRequest) Frontend() {}
 
 func (dst *CancelRequest) Decode(src []byte) error {
-	if len(src) != 12 {
+	if len(src) < 12 || len(src) > 8+maxSecretKeyLen {
 		return errors.New("bad cancel request size")
 	}
 
@@ -30,17 +31,17 @@ func (dst *CancelRequest) Decode(src []byte) error {
 	}
 
 	dst.ProcessID = binary.BigEndian.Uint32(src[4:])
-	dst.SecretKey = binary.BigEndian.Uint32(src[8:])
+	dst.SecretKey = src[8:]
 
 	return nil
 }
 
 // Encode encodes src into dst. dst will include the 4 byte message length.
 func (src *CancelRequest) Encode(dst []byte) ([]byte, error) {
-	dst = pgio.AppendInt32(dst, 16)
+	dst = pgio.AppendInt32(dst, int32(12+len(src.SecretKey)))
 	dst = pgio.AppendInt32(dst, cancelRequestCode)
 	dst = pgio.AppendUint32(dst, src.ProcessID)
-	dst = pgio.AppendUint32(dst, src.SecretKey)
+	dst = append(dst, src.SecretKey...)
 	return dst, nil
 }
 
@@ -49,10 +50,35 @@ func (src CancelRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Type      string
 		ProcessID uint32
-		SecretKey uint32
+		SecretKey string
 	}{
 		Type:      "CancelRequest",
 		ProcessID: src.ProcessID,
-		SecretKey: src.SecretKey,
+		SecretKey: hex.EncodeToString(src.SecretKey),
 	})
 }
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (dst *CancelRequest) UnmarshalJSON(data []byte) error {
+	// Ignore null, like in the main JSON package.
+	if string(data) == "null" {
+		return nil
+	}
+
+	var msg struct {
+		ProcessID uint32
+		SecretKey json.RawMessage
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	secretKey, err := unmarshalSecretKeyJSON(msg.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	dst.ProcessID = msg.ProcessID
+	dst.SecretKey = secretKey
+	return nil
+}
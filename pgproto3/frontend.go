@@ -43,6 +43,7 @@ type Frontend struct {
 	emptyQueryResponse              EmptyQueryResponse
 	errorResponse                   ErrorResponse
 	functionCallResponse            FunctionCallResponse
+	negotiateProtocolVersion        NegotiateProtocolVersion
 	noData                          NoData
 	noticeResponse                  NoticeResponse
 	notificationResponse            NotificationResponse
@@ -377,6 +378,8 @@ func (f *Frontend) Receive() (BackendMessage, error) {
 		msg = &f.parameterDescription
 	case 'T':
 		msg = &f.rowDescription
+	case 'v':
+		msg = &f.negotiateProtocolVersion
 	case 'V':
 		msg = &f.functionCallResponse
 	case 'W':
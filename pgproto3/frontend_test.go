@@ -133,3 +133,22 @@ func TestFrontendReceiveExceededMaxBodyLen(t *testing.T) {
 	var invalidBodyLenErr *pgproto3.ExceededMaxBodyLenErr
 	assert.ErrorAs(t, err, &invalidBodyLenErr)
 }
+
+func TestFrontendReceiveNegotiateProtocolVersion(t *testing.T) {
+	t.Parallel()
+
+	want := &pgproto3.NegotiateProtocolVersion{NewestMinorProtocol: 0, UnrecognizedOptions: []string{"_pq_.foo"}}
+	buf, err := want.Encode(nil)
+	require.NoError(t, err)
+
+	server := &interruptReader{}
+	server.push(buf)
+
+	frontend := pgproto3.NewFrontend(server, nil)
+	msg, err := frontend.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, want, msg)
+
+	err = (&pgproto3.NegotiateProtocolVersion{}).Decode([]byte{0, 0, 0, 0, 0, 0, 0, 2, 'a', 0})
+	require.Error(t, err)
+}
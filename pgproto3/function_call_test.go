@@ -21,6 +21,7 @@ func TestFunctionCall_EncodeDecode(t *testing.T) {
 		wantErr bool
 	}{
 		{"valid", fields{uint32(123), []uint16{0, 1, 0, 1}, [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}, uint16(1)}, false},
+		{"null argument", fields{uint32(123), []uint16{1}, [][]byte{[]byte("foo"), nil, []byte("baz")}, uint16(1)}, false},
 		{"invalid format code", fields{uint32(123), []uint16{2, 1, 0, 1}, [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}, uint16(0)}, true},
 		{"invalid result format code", fields{uint32(123), []uint16{1, 1, 0, 1}, [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}, uint16(2)}, true},
 	}
@@ -94,10 +94,11 @@ func TestJSONUnmarshalAuthenticationSASLFinal(t *testing.T) {
 }
 
 func TestJSONUnmarshalBackendKeyData(t *testing.T) {
+	// A 4 byte secret key may be a number for compatibility with the JSON of fixed length secret keys.
 	data := []byte(`{"Type":"BackendKeyData","ProcessID":8864,"SecretKey":3641487067}`)
 	want := BackendKeyData{
 		ProcessID: 8864,
-		SecretKey: 3641487067,
+		SecretKey: []byte{0xd9, 0x0c, 0xae, 0xdb},
 	}
 
 	var got BackendKeyData
@@ -107,6 +108,23 @@ func TestJSONUnmarshalBackendKeyData(t *testing.T) {
 	if !reflect.DeepEqual(got, want) {
 		t.Error("unmarshaled BackendKeyData struct doesn't match expected value")
 	}
+
+	data = []byte(`{"Type":"BackendKeyData","ProcessID":8864,"SecretKey":"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"}`)
+	want = BackendKeyData{
+		ProcessID: 8864,
+		SecretKey: []byte{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+			0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		},
+	}
+
+	got = BackendKeyData{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Errorf("cannot JSON unmarshal %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("unmarshaled BackendKeyData struct doesn't match expected value")
+	}
 }
 
 func TestJSONUnmarshalCommandComplete(t *testing.T) {
@@ -278,6 +296,22 @@ func TestJSONUnmarshalParameterDescription(t *testing.T) {
 	}
 }
 
+func TestJSONUnmarshalNegotiateProtocolVersion(t *testing.T) {
+	data := []byte(`{"Type":"NegotiateProtocolVersion","NewestMinorProtocol":0,"UnrecognizedOptions":["_pq_.foo"]}`)
+	want := NegotiateProtocolVersion{
+		NewestMinorProtocol: 0,
+		UnrecognizedOptions: []string{"_pq_.foo"},
+	}
+
+	var got NegotiateProtocolVersion
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Errorf("cannot JSON unmarshal %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("unmarshaled NegotiateProtocolVersion struct doesn't match expected value")
+	}
+}
+
 func TestJSONUnmarshalParameterStatus(t *testing.T) {
 	data := []byte(`{"Type":"ParameterStatus","Name":"TimeZone","Value":"Europe/Amsterdam"}`)
 	want := ParameterStatus{
@@ -367,10 +401,11 @@ func TestJSONUnmarshalBind(t *testing.T) {
 }
 
 func TestJSONUnmarshalCancelRequest(t *testing.T) {
+	// A 4 byte secret key may be a number for compatibility with the JSON of fixed length secret keys.
 	data := []byte(`{"Type":"CancelRequest","ProcessID":8864,"SecretKey":3641487067}`)
 	want := CancelRequest{
 		ProcessID: 8864,
-		SecretKey: 3641487067,
+		SecretKey: []byte{0xd9, 0x0c, 0xae, 0xdb},
 	}
 
 	var got CancelRequest
@@ -380,6 +415,23 @@ func TestJSONUnmarshalCancelRequest(t *testing.T) {
 	if !reflect.DeepEqual(got, want) {
 		t.Error("unmarshaled CancelRequest struct doesn't match expected value")
 	}
+
+	data = []byte(`{"Type":"CancelRequest","ProcessID":8864,"SecretKey":"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"}`)
+	want = CancelRequest{
+		ProcessID: 8864,
+		SecretKey: []byte{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+			0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		},
+	}
+
+	got = CancelRequest{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Errorf("cannot JSON unmarshal %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("unmarshaled CancelRequest struct doesn't match expected value")
+	}
 }
 
 func TestJSONUnmarshalClose(t *testing.T) {
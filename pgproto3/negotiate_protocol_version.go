@@ -0,0 +1,74 @@
+package pgproto3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/internal/pgio"
+)
+
+// NegotiateProtocolVersion is sent by the server in response to a StartupMessage when it does not support the
+// requested minor protocol version or does not recognize some of the requested protocol options.
+type NegotiateProtocolVersion struct {
+	NewestMinorProtocol uint32   // newest minor protocol version supported by the server for the requested major version
+	UnrecognizedOptions []string // protocol options (names beginning with "_pq_.") not recognized by the server
+}
+
+// Backend identifies this message as sendable by the PostgreSQL backend.
+func (*NegotiateProtocolVersion) Backend() {}
+
+// Decode decodes src into dst. src must contain the complete message with the exception of the initial 1 byte message
+// type identifier and 4 byte message length.
+func (dst *NegotiateProtocolVersion) Decode(src []byte) error {
+	if len(src) < 8 {
+		return &invalidMessageLenErr{messageType: "NegotiateProtocolVersion", expectedLen: 8, actualLen: len(src)}
+	}
+
+	newestMinorProtocol := binary.BigEndian.Uint32(src)
+	optionCount := int(binary.BigEndian.Uint32(src[4:]))
+	rp := 8
+
+	// Use the remaining length as an upper bound for the preallocation. Each option is at least 1 byte.
+	if optionCount > len(src[rp:]) {
+		return &invalidMessageFormatErr{messageType: "NegotiateProtocolVersion"}
+	}
+
+	options := make([]string, 0, optionCount)
+	for i := 0; i < optionCount; i++ {
+		idx := bytes.IndexByte(src[rp:], 0)
+		if idx < 0 {
+			return &invalidMessageFormatErr{messageType: "NegotiateProtocolVersion"}
+		}
+		options = append(options, string(src[rp:rp+idx]))
+		rp += idx + 1
+	}
+
+	*dst = NegotiateProtocolVersion{NewestMinorProtocol: newestMinorProtocol, UnrecognizedOptions: options}
+	return nil
+}
+
+// Encode encodes src into dst. dst will include the 1 byte message type identifier and the 4 byte message length.
+func (src *NegotiateProtocolVersion) Encode(dst []byte) ([]byte, error) {
+	dst, sp := beginMessage(dst, 'v')
+	dst = pgio.AppendUint32(dst, src.NewestMinorProtocol)
+	dst = pgio.AppendUint32(dst, uint32(len(src.UnrecognizedOptions)))
+	for _, option := range src.UnrecognizedOptions {
+		dst = append(dst, option...)
+		dst = append(dst, 0)
+	}
+	return finishMessage(dst, sp)
+}
+
+// MarshalJSON implements encoding/json.Marshaler.
+func (src NegotiateProtocolVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type                string
+		NewestMinorProtocol uint32
+		UnrecognizedOptions []string
+	}{
+		Type:                "NegotiateProtocolVersion",
+		NewestMinorProtocol: src.NewestMinorProtocol,
+		UnrecognizedOptions: src.UnrecognizedOptions,
+	})
+}
@@ -12,6 +12,13 @@ import (
 
 const ProtocolVersionNumber = 196608 // 3.0
 
+// Protocol versions that may be requested in a StartupMessage. The major version is in the high 16 bits and the minor
+// version in the low 16 bits. Protocol version 3.2 was introduced in PostgreSQL 18.
+const (
+	ProtocolVersion30 = 196608 // 3.0
+	ProtocolVersion32 = 196610 // 3.2
+)
+
 type StartupMessage struct {
 	ProtocolVersion uint32
 	Parameters      map[string]string
@@ -30,8 +37,8 @@ func (dst *StartupMessage) Decode(src []byte) error {
 	dst.ProtocolVersion = binary.BigEndian.Uint32(src)
 	rp := 4
 
-	if dst.ProtocolVersion != ProtocolVersionNumber {
-		return fmt.Errorf("Bad startup message version number. Expected %d, got %d", ProtocolVersionNumber, dst.ProtocolVersion)
+	if dst.ProtocolVersion>>16 != ProtocolVersionNumber>>16 {
+		return fmt.Errorf("Bad startup message version number. Expected major version 3, got %d", dst.ProtocolVersion)
 	}
 
 	dst.Parameters = make(map[string]string)
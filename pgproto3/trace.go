@@ -91,6 +91,8 @@ func (t *tracer) traceMessage(sender byte, encodedLen int32, msg Message) {
 		t.traceFunctionCallResponse(sender, encodedLen, msg)
 	case *GSSEncRequest:
 		t.traceGSSEncRequest(sender, encodedLen, msg)
+	case *NegotiateProtocolVersion:
+		t.traceNegotiateProtocolVersion(sender, encodedLen, msg)
 	case *NoData:
 		t.traceNoData(sender, encodedLen, msg)
 	case *NoticeResponse:
@@ -163,7 +165,7 @@ func (t *tracer) traceBackendKeyData(sender byte, encodedLen int32, msg *Backend
 		if t.RegressMode {
 			t.buf.WriteString("\t NNNN NNNN")
 		} else {
-			fmt.Fprintf(t.buf, "\t %d %d", msg.ProcessID, msg.SecretKey)
+			fmt.Fprintf(t.buf, "\t %d %x", msg.ProcessID, msg.SecretKey)
 		}
 	})
 }
@@ -282,6 +284,15 @@ func (t *tracer) traceGSSEncRequest(sender byte, encodedLen int32, msg *GSSEncRe
 	t.writeTrace(sender, encodedLen, "GSSEncRequest", nil)
 }
 
+func (t *tracer) traceNegotiateProtocolVersion(sender byte, encodedLen int32, msg *NegotiateProtocolVersion) {
+	t.writeTrace(sender, encodedLen, "NegotiateProtocolVersion", func() {
+		fmt.Fprintf(t.buf, "\t %d %d", msg.NewestMinorProtocol, len(msg.UnrecognizedOptions))
+		for _, option := range msg.UnrecognizedOptions {
+			fmt.Fprintf(t.buf, " %s", traceDoubleQuotedString([]byte(option)))
+		}
+	})
+}
+
 func (t *tracer) traceNoData(sender byte, encodedLen int32, msg *NoData) {
 	t.writeTrace(sender, encodedLen, "NoData", nil)
 }
@@ -0,0 +1,379 @@
+package pgrepl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// BaseBackupOptions are the options for the BASE_BACKUP command. See
+// https://www.postgresql.org/docs/current/protocol-replication.html#PROTOCOL-REPLICATION-BASE-BACKUP.
+type BaseBackupOptions struct {
+	// Label of the backup. If empty the server uses "base backup".
+	Label string
+
+	// Progress requests the size of each tablespace to be reported in BaseBackupResult.Tablespaces and progress
+	// messages to be sent during the backup on PostgreSQL 15 and later.
+	Progress bool
+
+	// Fast requests an immediate checkpoint instead of a spread checkpoint.
+	Fast bool
+
+	// WAL includes the WAL required to make the backup consistent in the base archive.
+	WAL bool
+
+	// NoWait causes the server not to wait for the required WAL to be archived.
+	NoWait bool
+
+	// MaxRate limits the transfer rate in kilobytes per second. 0 means unlimited.
+	MaxRate int32
+
+	// TablespaceMap includes information about symbolic links in the pg_tblspc directory in a file named
+	// tablespace_map.
+	TablespaceMap bool
+
+	// NoVerifyChecksums disables checksum verification during the backup.
+	NoVerifyChecksums bool
+
+	// Manifest is one of "yes", "no", or "force-encode". If empty the server default is used. The manifest is only
+	// supported on PostgreSQL 13 and later.
+	Manifest string
+
+	// ManifestChecksums is the checksum algorithm used for the files in the manifest (e.g. "CRC32C" or "SHA256"). If
+	// empty the server default is used.
+	ManifestChecksums string
+}
+
+// BaseBackupOutput is where BaseBackup writes the data streamed by the server.
+type BaseBackupOutput struct {
+	// Archive is called at the start of each archive. name is the name of the tar file (e.g. "base.tar") and
+	// tablespaceLocation is the location of the tablespace it contains or empty for the main data directory. The
+	// archive contents are written to the returned io.Writer. BaseBackup does not close it. If Archive is nil the
+	// archives are discarded.
+	Archive func(name, tablespaceLocation string) (io.Writer, error)
+
+	// Manifest receives the backup manifest. If nil the manifest is discarded.
+	Manifest io.Writer
+
+	// Progress is called with the total number of bytes streamed so far. It is only called on PostgreSQL 15 and later
+	// when BaseBackupOptions.Progress is set.
+	Progress func(bytesDone int64)
+}
+
+// BaseBackupTablespace describes a tablespace included in a base backup.
+type BaseBackupTablespace struct {
+	OID      uint32 // 0 for the main data directory
+	Location string // empty for the main data directory
+	Size     int64  // approximate size in bytes or -1 if not requested
+}
+
+// BaseBackupResult is the result of the BASE_BACKUP command.
+type BaseBackupResult struct {
+	StartLSN      LSN
+	StartTimeline int32
+	EndLSN        LSN
+	EndTimeline   int32
+	Tablespaces   []BaseBackupTablespace
+}
+
+// BaseBackup executes the BASE_BACKUP command and streams the backup to output. conn must be a physical replication
+// connection (replication=true). Archives are written in the order they are sent by the server.
+//
+// If writing to output fails or the response cannot be parsed the connection is closed and the error is returned.
+func BaseBackup(ctx context.Context, conn *pgconn.PgConn, options BaseBackupOptions, output BaseBackupOutput) (BaseBackupResult, error) {
+	var result BaseBackupResult
+
+	newProtocol := serverMajorVersion(conn) >= 15
+
+	conn.Frontend().SendQuery(&pgproto3.Query{String: baseBackupSQL(options, newProtocol)})
+	err := conn.Frontend().Flush()
+	if err != nil {
+		return result, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	bb := &baseBackupReader{output: output, result: &result, newProtocol: newProtocol}
+	var pgErr error
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("failed to receive message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.RowDescription:
+			bb.resultSet++
+		case *pgproto3.DataRow:
+			err = bb.handleDataRow(msg.Values)
+			if err != nil {
+				conn.Close(ctx)
+				return result, err
+			}
+		case *pgproto3.CopyOutResponse:
+			err = bb.handleCopyOutResponse()
+			if err != nil {
+				conn.Close(ctx)
+				return result, err
+			}
+		case *pgproto3.CopyData:
+			err = bb.handleCopyData(msg.Data)
+			if err != nil {
+				conn.Close(ctx)
+				return result, err
+			}
+		case *pgproto3.ErrorResponse:
+			pgErr = pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.ReadyForQuery:
+			if pgErr != nil {
+				return result, pgErr
+			}
+			return result, nil
+		}
+	}
+}
+
+// baseBackupSQL builds the BASE_BACKUP command. PostgreSQL 15 replaced the keyword options with a parenthesized option
+// list.
+func baseBackupSQL(options BaseBackupOptions, newProtocol bool) string {
+	var opts []string
+	if options.Label != "" {
+		opts = append(opts, "LABEL "+quoteString(options.Label))
+	}
+	if options.Progress {
+		opts = append(opts, "PROGRESS")
+	}
+	if options.Fast {
+		if newProtocol {
+			opts = append(opts, "CHECKPOINT 'fast'")
+		} else {
+			opts = append(opts, "FAST")
+		}
+	}
+	if options.WAL {
+		opts = append(opts, "WAL")
+	}
+	if options.NoWait {
+		if newProtocol {
+			opts = append(opts, "WAIT false")
+		} else {
+			opts = append(opts, "NOWAIT")
+		}
+	}
+	if options.MaxRate > 0 {
+		opts = append(opts, fmt.Sprintf("MAX_RATE %d", options.MaxRate))
+	}
+	if options.TablespaceMap {
+		opts = append(opts, "TABLESPACE_MAP")
+	}
+	if options.NoVerifyChecksums {
+		if newProtocol {
+			opts = append(opts, "VERIFY_CHECKSUMS false")
+		} else {
+			opts = append(opts, "NOVERIFY_CHECKSUMS")
+		}
+	}
+	if options.Manifest != "" {
+		opts = append(opts, "MANIFEST "+quoteString(options.Manifest))
+	}
+	if options.ManifestChecksums != "" {
+		opts = append(opts, "MANIFEST_CHECKSUMS "+quoteString(options.ManifestChecksums))
+	}
+
+	if len(opts) == 0 {
+		return "BASE_BACKUP"
+	}
+	if newProtocol {
+		return "BASE_BACKUP (" + strings.Join(opts, ", ") + ")"
+	}
+	return "BASE_BACKUP " + strings.Join(opts, " ")
+}
+
+// baseBackupReader tracks the state of a BASE_BACKUP response.
+//
+// The server sends a result set with the start position, a result set with the tablespaces, the archives, and a
+// result set with the end position. On PostgreSQL 15 and later all archives and the manifest are sent in a single copy
+// stream where the first byte of each CopyData identifies its contents. Older servers send one copy stream per
+// tablespace in the order of the tablespace result set followed by a copy stream for the manifest.
+type baseBackupReader struct {
+	output      BaseBackupOutput
+	result      *BaseBackupResult
+	newProtocol bool
+
+	resultSet   int
+	copyStreams int
+	w           io.Writer
+}
+
+func (bb *baseBackupReader) handleDataRow(values [][]byte) error {
+	switch bb.resultSet {
+	case 1:
+		lsn, timeline, err := parseLSNAndTimeline(values)
+		if err != nil {
+			return fmt.Errorf("failed to parse backup start position: %w", err)
+		}
+		bb.result.StartLSN = lsn
+		bb.result.StartTimeline = timeline
+	case 2:
+		if len(values) != 3 {
+			return fmt.Errorf("expected 3 tablespace columns, got %d", len(values))
+		}
+		ts := BaseBackupTablespace{Location: string(values[1]), Size: -1}
+		if values[0] != nil {
+			oid, err := strconv.ParseUint(string(values[0]), 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse tablespace oid: %w", err)
+			}
+			ts.OID = uint32(oid)
+		}
+		if values[2] != nil {
+			size, err := strconv.ParseInt(string(values[2]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse tablespace size: %w", err)
+			}
+			// The server reports the size in kilobytes.
+			ts.Size = size * 1024
+		}
+		bb.result.Tablespaces = append(bb.result.Tablespaces, ts)
+	default:
+		lsn, timeline, err := parseLSNAndTimeline(values)
+		if err != nil {
+			return fmt.Errorf("failed to parse backup end position: %w", err)
+		}
+		bb.result.EndLSN = lsn
+		bb.result.EndTimeline = timeline
+	}
+
+	return nil
+}
+
+func (bb *baseBackupReader) handleCopyOutResponse() error {
+	bb.copyStreams++
+	if bb.newProtocol {
+		bb.w = io.Discard
+		return nil
+	}
+
+	// Older servers send one copy stream per tablespace followed by the manifest.
+	n := bb.copyStreams - 1
+	if n >= len(bb.result.Tablespaces) {
+		bb.w = bb.output.Manifest
+		if bb.w == nil {
+			bb.w = io.Discard
+		}
+		return nil
+	}
+
+	ts := bb.result.Tablespaces[n]
+	name := "base.tar"
+	if ts.OID != 0 {
+		name = fmt.Sprintf("%d.tar", ts.OID)
+	}
+	return bb.startArchive(name, ts.Location)
+}
+
+func (bb *baseBackupReader) handleCopyData(data []byte) error {
+	if !bb.newProtocol {
+		return bb.write(data)
+	}
+
+	if len(data) == 0 {
+		return fmt.Errorf("received empty base backup message")
+	}
+
+	switch data[0] {
+	case 'n':
+		name, rest, ok := bytes.Cut(data[1:], []byte{0})
+		if !ok {
+			return fmt.Errorf("invalid base backup new archive message")
+		}
+		location, _, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return fmt.Errorf("invalid base backup new archive message")
+		}
+		return bb.startArchive(string(name), string(location))
+	case 'm':
+		bb.w = bb.output.Manifest
+		if bb.w == nil {
+			bb.w = io.Discard
+		}
+		return nil
+	case 'd':
+		return bb.write(data[1:])
+	case 'p':
+		if len(data) != 9 {
+			return fmt.Errorf("invalid base backup progress message")
+		}
+		if bb.output.Progress != nil {
+			bb.output.Progress(int64(binary.BigEndian.Uint64(data[1:])))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown base backup message type: %c", data[0])
+	}
+}
+
+func (bb *baseBackupReader) startArchive(name, tablespaceLocation string) error {
+	if bb.output.Archive == nil {
+		bb.w = io.Discard
+		return nil
+	}
+
+	w, err := bb.output.Archive(name, tablespaceLocation)
+	if err != nil {
+		return err
+	}
+	bb.w = w
+	return nil
+}
+
+func (bb *baseBackupReader) write(data []byte) error {
+	if bb.w == nil {
+		return fmt.Errorf("received base backup data before start of archive")
+	}
+	_, err := bb.w.Write(data)
+	return err
+}
+
+func parseLSNAndTimeline(values [][]byte) (LSN, int32, error) {
+	if len(values) != 2 {
+		return 0, 0, fmt.Errorf("expected 2 columns, got %d", len(values))
+	}
+
+	lsn, err := ParseLSN(string(values[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timeline, err := strconv.ParseInt(string(values[1]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse timeline: %w", err)
+	}
+
+	return lsn, int32(timeline), nil
+}
+
+// serverMajorVersion returns the major version of the server (e.g. 15) or 0 if it cannot be determined.
+func serverMajorVersion(conn *pgconn.PgConn) int {
+	version := conn.ParameterStatus("server_version")
+	end := 0
+	for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+		end++
+	}
+
+	major, err := strconv.Atoi(version[:end])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// quoteString quotes s as a replication command string literal.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,200 @@
+package pgrepl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func baseBackupPositionSteps(lsn string) []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("recptr"), DataTypeOID: 25},
+			{Name: []byte("tli"), DataTypeOID: 20},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte(lsn), []byte("1")}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT")}),
+	}
+}
+
+func baseBackupTablespaceSteps() []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("spcoid"), DataTypeOID: 26},
+			{Name: []byte("spclocation"), DataTypeOID: 25},
+			{Name: []byte("size"), DataTypeOID: 20},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("16384"), []byte("/mnt/ts"), []byte("8")}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{nil, nil, []byte("32")}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT")}),
+	}
+}
+
+type archiveRecorder struct {
+	names     []string
+	locations []string
+	archives  []*bytes.Buffer
+}
+
+func (ar *archiveRecorder) Archive(name, tablespaceLocation string) (io.Writer, error) {
+	ar.names = append(ar.names, name)
+	ar.locations = append(ar.locations, tablespaceLocation)
+	buf := &bytes.Buffer{}
+	ar.archives = append(ar.archives, buf)
+	return buf, nil
+}
+
+func TestBaseBackup(t *testing.T) {
+	t.Parallel()
+
+	steps := []pgmock.Step{
+		pgmock.ExpectAnyMessage(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{}}),
+		pgmock.SendMessage(&pgproto3.AuthenticationOk{}),
+		pgmock.SendMessage(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.2"}),
+		pgmock.SendMessage(&pgproto3.BackendKeyData{ProcessID: 0, SecretKey: []byte{0, 0, 0, 0}}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		pgmock.ExpectMessage(&pgproto3.Query{String: `BASE_BACKUP (LABEL 'it''s', PROGRESS, CHECKPOINT 'fast', WAIT false, MANIFEST 'yes')`}),
+	}
+	steps = append(steps, baseBackupPositionSteps("0/2000028")...)
+	steps = append(steps, baseBackupTablespaceSteps()...)
+
+	progress := binary.BigEndian.AppendUint64([]byte{'p'}, 12)
+	steps = append(steps,
+		pgmock.SendMessage(&pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("n16384.tar\x00/mnt/ts\x00")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("dtablespace")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("nbase.tar\x00\x00")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("dbase ")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("ddata")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: progress}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("m")}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("d{}")}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+	)
+	steps = append(steps, baseBackupPositionSteps("0/2000100")...)
+	steps = append(steps,
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("BASE_BACKUP")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	conn, serverErrChan := connectMockScript(t, &pgmock.Script{Steps: steps})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ar := &archiveRecorder{}
+	manifest := &bytes.Buffer{}
+	var progressBytes []int64
+	result, err := pgrepl.BaseBackup(ctx, conn,
+		pgrepl.BaseBackupOptions{Label: "it's", Progress: true, Fast: true, NoWait: true, Manifest: "yes"},
+		pgrepl.BaseBackupOutput{
+			Archive:  ar.Archive,
+			Manifest: manifest,
+			Progress: func(bytesDone int64) { progressBytes = append(progressBytes, bytesDone) },
+		},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, pgrepl.LSN(0x2000028), result.StartLSN)
+	assert.Equal(t, int32(1), result.StartTimeline)
+	assert.Equal(t, pgrepl.LSN(0x2000100), result.EndLSN)
+	assert.Equal(t, int32(1), result.EndTimeline)
+	assert.Equal(t, []pgrepl.BaseBackupTablespace{
+		{OID: 16384, Location: "/mnt/ts", Size: 8192},
+		{OID: 0, Location: "", Size: 32768},
+	}, result.Tablespaces)
+
+	assert.Equal(t, []string{"16384.tar", "base.tar"}, ar.names)
+	assert.Equal(t, []string{"/mnt/ts", ""}, ar.locations)
+	assert.Equal(t, "tablespace", ar.archives[0].String())
+	assert.Equal(t, "base data", ar.archives[1].String())
+	assert.Equal(t, "{}", manifest.String())
+	assert.Equal(t, []int64{12}, progressBytes)
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestBaseBackupBeforePostgreSQL15(t *testing.T) {
+	t.Parallel()
+
+	steps := []pgmock.Step{
+		pgmock.ExpectMessage(&pgproto3.Query{String: `BASE_BACKUP LABEL 'backup' FAST NOWAIT MANIFEST 'yes'`}),
+	}
+	steps = append(steps, baseBackupPositionSteps("0/2000028")...)
+	steps = append(steps, baseBackupTablespaceSteps()...)
+	steps = append(steps,
+		pgmock.SendMessage(&pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("tablespace")}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("base data")}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("{}")}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+	)
+	steps = append(steps, baseBackupPositionSteps("0/2000100")...)
+	steps = append(steps,
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("BASE_BACKUP")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	conn, serverErrChan := connectMock(t, steps...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ar := &archiveRecorder{}
+	manifest := &bytes.Buffer{}
+	result, err := pgrepl.BaseBackup(ctx, conn,
+		pgrepl.BaseBackupOptions{Label: "backup", Fast: true, NoWait: true, Manifest: "yes"},
+		pgrepl.BaseBackupOutput{Archive: ar.Archive, Manifest: manifest},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, pgrepl.LSN(0x2000028), result.StartLSN)
+	assert.Equal(t, pgrepl.LSN(0x2000100), result.EndLSN)
+
+	assert.Equal(t, []string{"16384.tar", "base.tar"}, ar.names)
+	assert.Equal(t, []string{"/mnt/ts", ""}, ar.locations)
+	assert.Equal(t, "tablespace", ar.archives[0].String())
+	assert.Equal(t, "base data", ar.archives[1].String())
+	assert.Equal(t, "{}", manifest.String())
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestBaseBackupArchiveError(t *testing.T) {
+	t.Parallel()
+
+	steps := []pgmock.Step{pgmock.ExpectAnyMessage(&pgproto3.Query{})}
+	steps = append(steps, baseBackupPositionSteps("0/2000028")...)
+	steps = append(steps, baseBackupTablespaceSteps()...)
+	steps = append(steps,
+		pgmock.SendMessage(&pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: []byte("tablespace")}),
+	)
+
+	conn, _ := connectMock(t, steps...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	archiveErr := errors.New("disk full")
+	_, err := pgrepl.BaseBackup(ctx, conn, pgrepl.BaseBackupOptions{}, pgrepl.BaseBackupOutput{
+		Archive: func(name, tablespaceLocation string) (io.Writer, error) { return nil, archiveErr },
+	})
+	require.ErrorIs(t, err, archiveErr)
+	assert.True(t, conn.IsClosed())
+}
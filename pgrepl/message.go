@@ -0,0 +1,626 @@
+package pgrepl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MessageType is the type of a pgoutput logical replication message. See
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html.
+type MessageType uint8
+
+// List of pgoutput message types.
+const (
+	MessageTypeBegin        MessageType = 'B'
+	MessageTypeMessage      MessageType = 'M'
+	MessageTypeCommit       MessageType = 'C'
+	MessageTypeOrigin       MessageType = 'O'
+	MessageTypeRelation     MessageType = 'R'
+	MessageTypeType         MessageType = 'Y'
+	MessageTypeInsert       MessageType = 'I'
+	MessageTypeUpdate       MessageType = 'U'
+	MessageTypeDelete       MessageType = 'D'
+	MessageTypeTruncate     MessageType = 'T'
+	MessageTypeStreamStart  MessageType = 'S'
+	MessageTypeStreamStop   MessageType = 'E'
+	MessageTypeStreamCommit MessageType = 'c'
+	MessageTypeStreamAbort  MessageType = 'A'
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeBegin:
+		return "Begin"
+	case MessageTypeMessage:
+		return "Message"
+	case MessageTypeCommit:
+		return "Commit"
+	case MessageTypeOrigin:
+		return "Origin"
+	case MessageTypeRelation:
+		return "Relation"
+	case MessageTypeType:
+		return "Type"
+	case MessageTypeInsert:
+		return "Insert"
+	case MessageTypeUpdate:
+		return "Update"
+	case MessageTypeDelete:
+		return "Delete"
+	case MessageTypeTruncate:
+		return "Truncate"
+	case MessageTypeStreamStart:
+		return "StreamStart"
+	case MessageTypeStreamStop:
+		return "StreamStop"
+	case MessageTypeStreamCommit:
+		return "StreamCommit"
+	case MessageTypeStreamAbort:
+		return "StreamAbort"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(t))
+	}
+}
+
+// Message is a pgoutput logical replication message.
+type Message interface {
+	Type() MessageType
+}
+
+// BeginMessage is the beginning of a transaction.
+type BeginMessage struct {
+	FinalLSN   LSN // final LSN of the transaction
+	CommitTime time.Time
+	Xid        uint32
+}
+
+// Type returns MessageTypeBegin.
+func (*BeginMessage) Type() MessageType { return MessageTypeBegin }
+
+// CommitMessage is the end of a transaction.
+type CommitMessage struct {
+	Flags             uint8 // currently unused
+	CommitLSN         LSN
+	TransactionEndLSN LSN
+	CommitTime        time.Time
+}
+
+// Type returns MessageTypeCommit.
+func (*CommitMessage) Type() MessageType { return MessageTypeCommit }
+
+// OriginMessage identifies the replication origin of the transaction.
+type OriginMessage struct {
+	CommitLSN LSN // commit LSN on the origin server
+	Name      string
+}
+
+// Type returns MessageTypeOrigin.
+func (*OriginMessage) Type() MessageType { return MessageTypeOrigin }
+
+// RelationMessageColumn describes a column of a relation.
+type RelationMessageColumn struct {
+	Flags        uint8 // 1 marks the column as part of the key
+	Name         string
+	DataType     uint32 // OID of the column data type
+	TypeModifier int32
+}
+
+// RelationMessage describes a relation. It is sent before the first change to a relation in a session and whenever
+// the definition of the relation changes.
+type RelationMessage struct {
+	Xid             uint32 // only set inside of a streamed transaction
+	RelationID      uint32
+	Namespace       string
+	RelationName    string
+	ReplicaIdentity uint8
+	ColumnNum       uint16
+	Columns         []*RelationMessageColumn
+}
+
+// Type returns MessageTypeRelation.
+func (*RelationMessage) Type() MessageType { return MessageTypeRelation }
+
+// TypeMessage describes a data type.
+type TypeMessage struct {
+	Xid       uint32 // only set inside of a streamed transaction
+	DataType  uint32 // OID of the data type
+	Namespace string
+	Name      string
+}
+
+// Type returns MessageTypeType.
+func (*TypeMessage) Type() MessageType { return MessageTypeType }
+
+// List of TupleDataColumn data types.
+const (
+	TupleDataTypeNull   = uint8('n')
+	TupleDataTypeToast  = uint8('u') // unchanged TOASTed value; the actual value is not sent
+	TupleDataTypeText   = uint8('t')
+	TupleDataTypeBinary = uint8('b')
+)
+
+// List of old tuple types of UpdateMessage and DeleteMessage.
+const (
+	UpdateMessageTupleTypeKey = uint8('K')
+	UpdateMessageTupleTypeOld = uint8('O')
+	DeleteMessageTupleTypeKey = UpdateMessageTupleTypeKey
+	DeleteMessageTupleTypeOld = UpdateMessageTupleTypeOld
+)
+
+// TupleDataColumn is a single column value of a tuple.
+type TupleDataColumn struct {
+	DataType uint8 // one of TupleDataTypeNull, TupleDataTypeToast, TupleDataTypeText, or TupleDataTypeBinary
+	Length   uint32
+	Data     []byte
+}
+
+// TupleData is the column values of a row.
+type TupleData struct {
+	ColumnNum uint16
+	Columns   []*TupleDataColumn
+}
+
+// InsertMessage is an inserted row.
+type InsertMessage struct {
+	Xid        uint32 // only set inside of a streamed transaction
+	RelationID uint32
+	Tuple      *TupleData
+}
+
+// Type returns MessageTypeInsert.
+func (*InsertMessage) Type() MessageType { return MessageTypeInsert }
+
+// UpdateMessage is an updated row. OldTuple is only present when the replica identity includes changed key columns
+// (OldTupleType is UpdateMessageTupleTypeKey) or is FULL (OldTupleType is UpdateMessageTupleTypeOld).
+type UpdateMessage struct {
+	Xid          uint32 // only set inside of a streamed transaction
+	RelationID   uint32
+	OldTupleType uint8
+	OldTuple     *TupleData
+	NewTuple     *TupleData
+}
+
+// Type returns MessageTypeUpdate.
+func (*UpdateMessage) Type() MessageType { return MessageTypeUpdate }
+
+// DeleteMessage is a deleted row. OldTuple contains the key columns (OldTupleType is DeleteMessageTupleTypeKey) or the
+// entire row (OldTupleType is DeleteMessageTupleTypeOld) depending on the replica identity.
+type DeleteMessage struct {
+	Xid          uint32 // only set inside of a streamed transaction
+	RelationID   uint32
+	OldTupleType uint8
+	OldTuple     *TupleData
+}
+
+// Type returns MessageTypeDelete.
+func (*DeleteMessage) Type() MessageType { return MessageTypeDelete }
+
+// List of TruncateMessage options.
+const (
+	TruncateOptionCascade         = uint8(1)
+	TruncateOptionRestartIdentity = uint8(2)
+)
+
+// TruncateMessage is a truncation of one or more relations.
+type TruncateMessage struct {
+	Xid         uint32 // only set inside of a streamed transaction
+	RelationNum uint32
+	Option      uint8
+	RelationIDs []uint32
+}
+
+// Type returns MessageTypeTruncate.
+func (*TruncateMessage) Type() MessageType { return MessageTypeTruncate }
+
+// LogicalDecodingMessage is a message written with pg_logical_emit_message. It is only sent when the messages option
+// of pgoutput is enabled.
+type LogicalDecodingMessage struct {
+	Xid           uint32 // only set inside of a streamed transaction
+	Transactional bool
+	LSN           LSN
+	Prefix        string
+	Content       []byte
+}
+
+// Type returns MessageTypeMessage.
+func (*LogicalDecodingMessage) Type() MessageType { return MessageTypeMessage }
+
+// StreamStartMessage is the start of a block of changes of a streamed in-progress transaction.
+type StreamStartMessage struct {
+	Xid          uint32
+	FirstSegment bool
+}
+
+// Type returns MessageTypeStreamStart.
+func (*StreamStartMessage) Type() MessageType { return MessageTypeStreamStart }
+
+// StreamStopMessage is the end of a block of changes of a streamed in-progress transaction.
+type StreamStopMessage struct{}
+
+// Type returns MessageTypeStreamStop.
+func (*StreamStopMessage) Type() MessageType { return MessageTypeStreamStop }
+
+// StreamCommitMessage is the commit of a streamed transaction.
+type StreamCommitMessage struct {
+	Xid               uint32
+	Flags             uint8 // currently unused
+	CommitLSN         LSN
+	TransactionEndLSN LSN
+	CommitTime        time.Time
+}
+
+// Type returns MessageTypeStreamCommit.
+func (*StreamCommitMessage) Type() MessageType { return MessageTypeStreamCommit }
+
+// StreamAbortMessage is the abort of a streamed transaction or subtransaction. AbortLSN and AbortTime are only sent
+// by servers streaming in parallel mode (protocol version 4).
+type StreamAbortMessage struct {
+	Xid       uint32
+	SubXid    uint32
+	AbortLSN  LSN
+	AbortTime time.Time
+}
+
+// Type returns MessageTypeStreamAbort.
+func (*StreamAbortMessage) Type() MessageType { return MessageTypeStreamAbort }
+
+// ParseMessage parses a pgoutput message. data is the WALData of an XLogData message. inStream must be true when data
+// was received between a StreamStartMessage and a StreamStopMessage as change messages then carry a transaction ID.
+// Decoder can be used to track this automatically.
+func ParseMessage(data []byte, inStream bool) (Message, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty pgoutput message")
+	}
+
+	r := &msgReader{buf: data[1:]}
+	msgType := MessageType(data[0])
+
+	var msg Message
+	switch msgType {
+	case MessageTypeBegin:
+		msg = &BeginMessage{
+			FinalLSN:   LSN(r.uint64()),
+			CommitTime: pgTimeToTime(int64(r.uint64())),
+			Xid:        r.uint32(),
+		}
+	case MessageTypeCommit:
+		msg = &CommitMessage{
+			Flags:             r.uint8(),
+			CommitLSN:         LSN(r.uint64()),
+			TransactionEndLSN: LSN(r.uint64()),
+			CommitTime:        pgTimeToTime(int64(r.uint64())),
+		}
+	case MessageTypeOrigin:
+		msg = &OriginMessage{
+			CommitLSN: LSN(r.uint64()),
+			Name:      r.string(),
+		}
+	case MessageTypeRelation:
+		m := &RelationMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.RelationID = r.uint32()
+		m.Namespace = r.string()
+		m.RelationName = r.string()
+		m.ReplicaIdentity = r.uint8()
+		m.ColumnNum = r.uint16()
+		m.Columns = make([]*RelationMessageColumn, 0, min(int(m.ColumnNum), len(r.buf)))
+		for i := 0; i < int(m.ColumnNum) && r.err == nil; i++ {
+			m.Columns = append(m.Columns, &RelationMessageColumn{
+				Flags:        r.uint8(),
+				Name:         r.string(),
+				DataType:     r.uint32(),
+				TypeModifier: r.int32(),
+			})
+		}
+		msg = m
+	case MessageTypeType:
+		m := &TypeMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.DataType = r.uint32()
+		m.Namespace = r.string()
+		m.Name = r.string()
+		msg = m
+	case MessageTypeInsert:
+		m := &InsertMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.RelationID = r.uint32()
+		if kind := r.uint8(); kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("invalid Insert message: expected new tuple but got %q", kind)
+		}
+		m.Tuple = r.tupleData()
+		msg = m
+	case MessageTypeUpdate:
+		m := &UpdateMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.RelationID = r.uint32()
+		kind := r.uint8()
+		if kind == UpdateMessageTupleTypeKey || kind == UpdateMessageTupleTypeOld {
+			m.OldTupleType = kind
+			m.OldTuple = r.tupleData()
+			kind = r.uint8()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("invalid Update message: expected new tuple but got %q", kind)
+		}
+		m.NewTuple = r.tupleData()
+		msg = m
+	case MessageTypeDelete:
+		m := &DeleteMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.RelationID = r.uint32()
+		m.OldTupleType = r.uint8()
+		if m.OldTupleType != DeleteMessageTupleTypeKey && m.OldTupleType != DeleteMessageTupleTypeOld && r.err == nil {
+			return nil, fmt.Errorf("invalid Delete message: unknown tuple type %q", m.OldTupleType)
+		}
+		m.OldTuple = r.tupleData()
+		msg = m
+	case MessageTypeTruncate:
+		m := &TruncateMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.RelationNum = r.uint32()
+		m.Option = r.uint8()
+		m.RelationIDs = make([]uint32, 0, min(int(m.RelationNum), len(r.buf)/4))
+		for i := 0; i < int(m.RelationNum) && r.err == nil; i++ {
+			m.RelationIDs = append(m.RelationIDs, r.uint32())
+		}
+		msg = m
+	case MessageTypeMessage:
+		m := &LogicalDecodingMessage{}
+		if inStream {
+			m.Xid = r.uint32()
+		}
+		m.Transactional = r.uint8() == 1
+		m.LSN = LSN(r.uint64())
+		m.Prefix = r.string()
+		m.Content = r.next(int(r.uint32()))
+		msg = m
+	case MessageTypeStreamStart:
+		msg = &StreamStartMessage{
+			Xid:          r.uint32(),
+			FirstSegment: r.uint8() == 1,
+		}
+	case MessageTypeStreamStop:
+		msg = &StreamStopMessage{}
+	case MessageTypeStreamCommit:
+		msg = &StreamCommitMessage{
+			Xid:               r.uint32(),
+			Flags:             r.uint8(),
+			CommitLSN:         LSN(r.uint64()),
+			TransactionEndLSN: LSN(r.uint64()),
+			CommitTime:        pgTimeToTime(int64(r.uint64())),
+		}
+	case MessageTypeStreamAbort:
+		m := &StreamAbortMessage{
+			Xid:    r.uint32(),
+			SubXid: r.uint32(),
+		}
+		if len(r.buf) >= 16 {
+			m.AbortLSN = LSN(r.uint64())
+			m.AbortTime = pgTimeToTime(int64(r.uint64()))
+		}
+		msg = m
+	default:
+		return nil, fmt.Errorf("unknown pgoutput message type: %v", msgType)
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid %v message: %w", msgType, r.err)
+	}
+
+	return msg, nil
+}
+
+// Decoder parses a stream of pgoutput messages. It tracks whether a streamed transaction is in progress and caches
+// RelationMessages so the column values of tuples can be decoded into Go values. A Decoder is not safe for concurrent
+// use.
+type Decoder struct {
+	typeMap   *pgtype.Map
+	relations map[uint32]*RelationMessage
+	inStream  bool
+}
+
+// NewDecoder returns a new Decoder that uses typeMap to decode column values. If typeMap is nil pgtype.NewMap() is
+// used.
+func NewDecoder(typeMap *pgtype.Map) *Decoder {
+	if typeMap == nil {
+		typeMap = pgtype.NewMap()
+	}
+
+	return &Decoder{
+		typeMap:   typeMap,
+		relations: make(map[uint32]*RelationMessage),
+	}
+}
+
+// Decode parses the pgoutput message in data. data is the WALData of an XLogData message.
+func (d *Decoder) Decode(data []byte) (Message, error) {
+	msg, err := ParseMessage(data, d.inStream)
+	if err != nil {
+		return nil, err
+	}
+
+	switch msg := msg.(type) {
+	case *RelationMessage:
+		d.relations[msg.RelationID] = msg
+	case *StreamStartMessage:
+		d.inStream = true
+	case *StreamStopMessage:
+		d.inStream = false
+	}
+
+	return msg, nil
+}
+
+// Relation returns the most recently received RelationMessage for relationID.
+func (d *Decoder) Relation(relationID uint32) (*RelationMessage, bool) {
+	rel, ok := d.relations[relationID]
+	return rel, ok
+}
+
+// DecodeTuple decodes the column values of tuple of the relation relationID into a map of column name to Go value.
+// The column data types are taken from the cached RelationMessage. NULL columns are mapped to nil. Unchanged TOASTed
+// columns are omitted as their value is not sent by the server. Values of data types unknown to the type map are
+// returned as a string for text format or a []byte for binary format.
+func (d *Decoder) DecodeTuple(relationID uint32, tuple *TupleData) (map[string]any, error) {
+	rel, ok := d.relations[relationID]
+	if !ok {
+		return nil, fmt.Errorf("unknown relation ID %d", relationID)
+	}
+
+	if tuple == nil {
+		return nil, nil
+	}
+
+	if len(tuple.Columns) > len(rel.Columns) {
+		return nil, fmt.Errorf("tuple has %d columns but relation %s.%s has %d", len(tuple.Columns), rel.Namespace, rel.RelationName, len(rel.Columns))
+	}
+
+	values := make(map[string]any, len(tuple.Columns))
+	for i, col := range tuple.Columns {
+		relCol := rel.Columns[i]
+		switch col.DataType {
+		case TupleDataTypeNull:
+			values[relCol.Name] = nil
+		case TupleDataTypeToast:
+		case TupleDataTypeText, TupleDataTypeBinary:
+			format := int16(pgtype.TextFormatCode)
+			if col.DataType == TupleDataTypeBinary {
+				format = pgtype.BinaryFormatCode
+			}
+
+			value, err := d.decodeValue(relCol.DataType, format, col.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode column %s: %w", relCol.Name, err)
+			}
+			values[relCol.Name] = value
+		default:
+			return nil, fmt.Errorf("unknown tuple column data type %q for column %s", col.DataType, relCol.Name)
+		}
+	}
+
+	return values, nil
+}
+
+func (d *Decoder) decodeValue(oid uint32, format int16, data []byte) (any, error) {
+	if dt, ok := d.typeMap.TypeForOID(oid); ok {
+		return dt.Codec.DecodeValue(d.typeMap, oid, format, data)
+	}
+
+	if format == pgtype.TextFormatCode {
+		return string(data), nil
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// msgReader reads big-endian values from buf. The first read past the end of buf sets err and all later reads return
+// zero values.
+type msgReader struct {
+	buf []byte
+	err error
+}
+
+var errShortMessage = errors.New("message too short")
+
+func (r *msgReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *msgReader) uint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *msgReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *msgReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *msgReader) int32() int32 {
+	return int32(r.uint32())
+}
+
+func (r *msgReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// string reads a null-terminated string.
+func (r *msgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+
+	r.err = errors.New("string not null-terminated")
+	return ""
+}
+
+func (r *msgReader) tupleData() *TupleData {
+	td := &TupleData{ColumnNum: r.uint16()}
+	td.Columns = make([]*TupleDataColumn, 0, min(int(td.ColumnNum), len(r.buf)))
+	for i := 0; i < int(td.ColumnNum) && r.err == nil; i++ {
+		col := &TupleDataColumn{DataType: r.uint8()}
+		switch col.DataType {
+		case TupleDataTypeNull, TupleDataTypeToast:
+		case TupleDataTypeText, TupleDataTypeBinary:
+			col.Length = r.uint32()
+			col.Data = r.next(int(col.Length))
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unknown tuple column data type %q", col.DataType)
+			}
+		}
+		td.Columns = append(td.Columns, col)
+	}
+
+	return td
+}
@@ -0,0 +1,270 @@
+package pgrepl_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCommitTime = time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+
+func appendPgTime(buf []byte, t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(t.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Microseconds()))
+}
+
+func appendCString(buf []byte, s string) []byte {
+	return append(append(buf, s...), 0)
+}
+
+func appendTextColumn(buf []byte, s string) []byte {
+	buf = append(buf, 't')
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func relationMessageData(inStream bool) []byte {
+	buf := []byte{'R'}
+	if inStream {
+		buf = binary.BigEndian.AppendUint32(buf, 42)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, 16384)
+	buf = appendCString(buf, "public")
+	buf = appendCString(buf, "users")
+	buf = append(buf, 'd')
+	buf = binary.BigEndian.AppendUint16(buf, 3)
+
+	buf = append(buf, 1)
+	buf = appendCString(buf, "id")
+	buf = binary.BigEndian.AppendUint32(buf, pgtype.Int4OID)
+	buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF)
+
+	buf = append(buf, 0)
+	buf = appendCString(buf, "name")
+	buf = binary.BigEndian.AppendUint32(buf, pgtype.TextOID)
+	buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF)
+
+	buf = append(buf, 0)
+	buf = appendCString(buf, "bio")
+	buf = binary.BigEndian.AppendUint32(buf, pgtype.TextOID)
+	buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF)
+
+	return buf
+}
+
+func TestParseMessageTransaction(t *testing.T) {
+	t.Parallel()
+
+	begin := []byte{'B'}
+	begin = binary.BigEndian.AppendUint64(begin, 0x1000)
+	begin = appendPgTime(begin, testCommitTime)
+	begin = binary.BigEndian.AppendUint32(begin, 742)
+
+	msg, err := pgrepl.ParseMessage(begin, false)
+	require.NoError(t, err)
+	require.Equal(t, pgrepl.MessageTypeBegin, msg.Type())
+	beginMsg := msg.(*pgrepl.BeginMessage)
+	assert.Equal(t, pgrepl.LSN(0x1000), beginMsg.FinalLSN)
+	assert.True(t, testCommitTime.Equal(beginMsg.CommitTime))
+	assert.Equal(t, uint32(742), beginMsg.Xid)
+
+	commit := []byte{'C', 0}
+	commit = binary.BigEndian.AppendUint64(commit, 0x1000)
+	commit = binary.BigEndian.AppendUint64(commit, 0x1010)
+	commit = appendPgTime(commit, testCommitTime)
+
+	msg, err = pgrepl.ParseMessage(commit, false)
+	require.NoError(t, err)
+	commitMsg := msg.(*pgrepl.CommitMessage)
+	assert.Equal(t, pgrepl.LSN(0x1000), commitMsg.CommitLSN)
+	assert.Equal(t, pgrepl.LSN(0x1010), commitMsg.TransactionEndLSN)
+	assert.True(t, testCommitTime.Equal(commitMsg.CommitTime))
+
+	origin := []byte{'O'}
+	origin = binary.BigEndian.AppendUint64(origin, 0x2000)
+	origin = appendCString(origin, "upstream")
+
+	msg, err = pgrepl.ParseMessage(origin, false)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.OriginMessage{CommitLSN: 0x2000, Name: "upstream"}, msg)
+}
+
+func TestParseMessageChanges(t *testing.T) {
+	t.Parallel()
+
+	msg, err := pgrepl.ParseMessage(relationMessageData(false), false)
+	require.NoError(t, err)
+	rel := msg.(*pgrepl.RelationMessage)
+	assert.Equal(t, uint32(16384), rel.RelationID)
+	assert.Equal(t, "public", rel.Namespace)
+	assert.Equal(t, "users", rel.RelationName)
+	assert.Equal(t, uint8('d'), rel.ReplicaIdentity)
+	require.Len(t, rel.Columns, 3)
+	assert.Equal(t, &pgrepl.RelationMessageColumn{Flags: 1, Name: "id", DataType: pgtype.Int4OID, TypeModifier: -1}, rel.Columns[0])
+
+	update := []byte{'U'}
+	update = binary.BigEndian.AppendUint32(update, 16384)
+	update = append(update, 'K')
+	update = binary.BigEndian.AppendUint16(update, 3)
+	update = appendTextColumn(update, "1")
+	update = append(update, 'n', 'n')
+	update = append(update, 'N')
+	update = binary.BigEndian.AppendUint16(update, 3)
+	update = appendTextColumn(update, "2")
+	update = appendTextColumn(update, "Jack")
+	update = append(update, 'u')
+
+	msg, err = pgrepl.ParseMessage(update, false)
+	require.NoError(t, err)
+	updateMsg := msg.(*pgrepl.UpdateMessage)
+	assert.Equal(t, uint32(16384), updateMsg.RelationID)
+	assert.Equal(t, pgrepl.UpdateMessageTupleTypeKey, updateMsg.OldTupleType)
+	require.NotNil(t, updateMsg.OldTuple)
+	assert.Equal(t, []byte("1"), updateMsg.OldTuple.Columns[0].Data)
+	require.Len(t, updateMsg.NewTuple.Columns, 3)
+	assert.Equal(t, []byte("Jack"), updateMsg.NewTuple.Columns[1].Data)
+	assert.Equal(t, pgrepl.TupleDataTypeToast, updateMsg.NewTuple.Columns[2].DataType)
+
+	del := []byte{'D'}
+	del = binary.BigEndian.AppendUint32(del, 16384)
+	del = append(del, 'O')
+	del = binary.BigEndian.AppendUint16(del, 1)
+	del = appendTextColumn(del, "2")
+
+	msg, err = pgrepl.ParseMessage(del, false)
+	require.NoError(t, err)
+	deleteMsg := msg.(*pgrepl.DeleteMessage)
+	assert.Equal(t, pgrepl.DeleteMessageTupleTypeOld, deleteMsg.OldTupleType)
+	assert.Equal(t, []byte("2"), deleteMsg.OldTuple.Columns[0].Data)
+
+	truncate := []byte{'T'}
+	truncate = binary.BigEndian.AppendUint32(truncate, 2)
+	truncate = append(truncate, pgrepl.TruncateOptionCascade)
+	truncate = binary.BigEndian.AppendUint32(truncate, 16384)
+	truncate = binary.BigEndian.AppendUint32(truncate, 16390)
+
+	msg, err = pgrepl.ParseMessage(truncate, false)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.TruncateMessage{RelationNum: 2, Option: pgrepl.TruncateOptionCascade, RelationIDs: []uint32{16384, 16390}}, msg)
+
+	typ := []byte{'Y'}
+	typ = binary.BigEndian.AppendUint32(typ, 16400)
+	typ = appendCString(typ, "public")
+	typ = appendCString(typ, "mood")
+
+	msg, err = pgrepl.ParseMessage(typ, false)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.TypeMessage{DataType: 16400, Namespace: "public", Name: "mood"}, msg)
+
+	ldm := []byte{'M', 1}
+	ldm = binary.BigEndian.AppendUint64(ldm, 0x3000)
+	ldm = appendCString(ldm, "audit")
+	ldm = binary.BigEndian.AppendUint32(ldm, 5)
+	ldm = append(ldm, "hello"...)
+
+	msg, err = pgrepl.ParseMessage(ldm, false)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.LogicalDecodingMessage{Transactional: true, LSN: 0x3000, Prefix: "audit", Content: []byte("hello")}, msg)
+}
+
+func TestParseMessageStreaming(t *testing.T) {
+	t.Parallel()
+
+	streamStart := []byte{'S'}
+	streamStart = binary.BigEndian.AppendUint32(streamStart, 42)
+	streamStart = append(streamStart, 1)
+
+	insert := []byte{'I'}
+	insert = binary.BigEndian.AppendUint32(insert, 42)
+	insert = binary.BigEndian.AppendUint32(insert, 16384)
+	insert = append(insert, 'N')
+	insert = binary.BigEndian.AppendUint16(insert, 3)
+	insert = appendTextColumn(insert, "7")
+	insert = appendTextColumn(insert, "Alice")
+	insert = append(insert, 'n')
+
+	streamCommit := []byte{'c'}
+	streamCommit = binary.BigEndian.AppendUint32(streamCommit, 42)
+	streamCommit = append(streamCommit, 0)
+	streamCommit = binary.BigEndian.AppendUint64(streamCommit, 0x4000)
+	streamCommit = binary.BigEndian.AppendUint64(streamCommit, 0x4010)
+	streamCommit = appendPgTime(streamCommit, testCommitTime)
+
+	streamAbort := []byte{'A'}
+	streamAbort = binary.BigEndian.AppendUint32(streamAbort, 43)
+	streamAbort = binary.BigEndian.AppendUint32(streamAbort, 44)
+
+	streamAbortParallel := binary.BigEndian.AppendUint64(append([]byte{}, streamAbort...), 0x5000)
+	streamAbortParallel = appendPgTime(streamAbortParallel, testCommitTime)
+
+	decoder := pgrepl.NewDecoder(nil)
+
+	msg, err := decoder.Decode(streamStart)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.StreamStartMessage{Xid: 42, FirstSegment: true}, msg)
+
+	msg, err = decoder.Decode(relationMessageData(true))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(42), msg.(*pgrepl.RelationMessage).Xid)
+
+	msg, err = decoder.Decode(insert)
+	require.NoError(t, err)
+	insertMsg := msg.(*pgrepl.InsertMessage)
+	assert.Equal(t, uint32(42), insertMsg.Xid)
+	assert.Equal(t, uint32(16384), insertMsg.RelationID)
+
+	values, err := decoder.DecodeTuple(insertMsg.RelationID, insertMsg.Tuple)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": int32(7), "name": "Alice", "bio": nil}, values)
+
+	msg, err = decoder.Decode([]byte{'E'})
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.StreamStopMessage{}, msg)
+
+	msg, err = decoder.Decode(streamCommit)
+	require.NoError(t, err)
+	streamCommitMsg := msg.(*pgrepl.StreamCommitMessage)
+	assert.Equal(t, uint32(42), streamCommitMsg.Xid)
+	assert.Equal(t, pgrepl.LSN(0x4000), streamCommitMsg.CommitLSN)
+	assert.Equal(t, pgrepl.LSN(0x4010), streamCommitMsg.TransactionEndLSN)
+	assert.True(t, testCommitTime.Equal(streamCommitMsg.CommitTime))
+
+	msg, err = decoder.Decode(streamAbort)
+	require.NoError(t, err)
+	assert.Equal(t, &pgrepl.StreamAbortMessage{Xid: 43, SubXid: 44}, msg)
+
+	msg, err = decoder.Decode(streamAbortParallel)
+	require.NoError(t, err)
+	streamAbortMsg := msg.(*pgrepl.StreamAbortMessage)
+	assert.Equal(t, pgrepl.LSN(0x5000), streamAbortMsg.AbortLSN)
+	assert.True(t, testCommitTime.Equal(streamAbortMsg.AbortTime))
+}
+
+func TestDecoderDecodeTupleUnknownRelation(t *testing.T) {
+	t.Parallel()
+
+	decoder := pgrepl.NewDecoder(pgtype.NewMap())
+	_, err := decoder.DecodeTuple(1, &pgrepl.TupleData{})
+	require.Error(t, err)
+}
+
+func TestParseMessageInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [][]byte{
+		{},
+		{'?'},
+		{'B', 0, 0},
+		{'O', 0, 0, 0, 0, 0, 0, 0, 0, 'a'},
+		relationMessageData(false)[:25],
+		{'I', 0, 0, 0, 1, 'X'},
+		{'I', 0, 0, 0, 1, 'N', 0, 1, 't', 0, 0, 0, 9, 'a'},
+	} {
+		_, err := pgrepl.ParseMessage(data, false)
+		assert.Errorf(t, err, "%v", data)
+	}
+}
@@ -0,0 +1,511 @@
+// Package pgrepl implements a client for the PostgreSQL streaming replication protocol.
+//
+// The functions in this package operate on a *pgconn.PgConn that was established with the replication run-time
+// parameter. For logical replication this is typically done by adding replication=database to the connection string.
+// Physical replication and BaseBackup require replication=true.
+// See https://www.postgresql.org/docs/current/protocol-replication.html for details of the protocol.
+package pgrepl
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// Message identifiers of the messages that are sent inside of CopyData messages during streaming replication.
+const (
+	XLogDataByteID                = 'w'
+	PrimaryKeepaliveMessageByteID = 'k'
+	StandbyStatusUpdateByteID     = 'r'
+)
+
+// microsecFromUnixEpochToY2K is the number of microseconds between the Unix epoch and the PostgreSQL epoch of
+// 2000-01-01.
+const microsecFromUnixEpochToY2K = 946684800 * 1000000
+
+// LSN is a PostgreSQL Log Sequence Number. It is a 64-bit position in the write-ahead log. See
+// https://www.postgresql.org/docs/current/datatype-pg-lsn.html.
+type LSN uint64
+
+// String formats the LSN in the PostgreSQL text format (e.g. 16/B374D848).
+func (lsn LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// ParseLSN parses the PostgreSQL text format of an LSN.
+func ParseLSN(s string) (LSN, error) {
+	upper, lower, found := strings.Cut(s, "/")
+	if !found {
+		return 0, fmt.Errorf("invalid LSN: %q", s)
+	}
+
+	upperHalf, err := strconv.ParseUint(upper, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN: %q: %w", s, err)
+	}
+	lowerHalf, err := strconv.ParseUint(lower, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN: %q: %w", s, err)
+	}
+
+	return LSN(upperHalf<<32 | lowerHalf), nil
+}
+
+// Scan implements the database/sql Scanner interface.
+func (lsn *LSN) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		parsed, err := ParseLSN(src)
+		if err != nil {
+			return err
+		}
+		*lsn = parsed
+		return nil
+	case []byte:
+		parsed, err := ParseLSN(string(src))
+		if err != nil {
+			return err
+		}
+		*lsn = parsed
+		return nil
+	case nil:
+		return errors.New("cannot scan NULL into *pgrepl.LSN")
+	}
+
+	return fmt.Errorf("cannot scan %T into *pgrepl.LSN", src)
+}
+
+// Value implements the database/sql/driver Valuer interface.
+func (lsn LSN) Value() (driver.Value, error) {
+	return lsn.String(), nil
+}
+
+// IdentifySystemResult is the parsed result of the IDENTIFY_SYSTEM command.
+type IdentifySystemResult struct {
+	SystemID string // unique system identifier of the cluster
+	Timeline int32  // current timeline ID
+	XLogPos  LSN    // current WAL flush location
+	DBName   string // database connected to or empty for physical replication connections
+}
+
+// IdentifySystem executes the IDENTIFY_SYSTEM command. It requests the server to identify itself.
+func IdentifySystem(ctx context.Context, conn *pgconn.PgConn) (IdentifySystemResult, error) {
+	return ParseIdentifySystem(conn.Exec(ctx, "IDENTIFY_SYSTEM"))
+}
+
+// ParseIdentifySystem parses the result of the IDENTIFY_SYSTEM command.
+func ParseIdentifySystem(mrr *pgconn.MultiResultReader) (IdentifySystemResult, error) {
+	var isr IdentifySystemResult
+	results, err := mrr.ReadAll()
+	if err != nil {
+		return isr, err
+	}
+
+	if len(results) != 1 {
+		return isr, fmt.Errorf("expected 1 result set, got %d", len(results))
+	}
+
+	result := results[0]
+	if len(result.Rows) != 1 {
+		return isr, fmt.Errorf("expected 1 result row, got %d", len(result.Rows))
+	}
+
+	row := result.Rows[0]
+	if len(row) != 4 {
+		return isr, fmt.Errorf("expected 4 result columns, got %d", len(row))
+	}
+
+	isr.SystemID = string(row[0])
+	timeline, err := strconv.ParseInt(string(row[1]), 10, 32)
+	if err != nil {
+		return isr, fmt.Errorf("failed to parse timeline: %w", err)
+	}
+	isr.Timeline = int32(timeline)
+
+	isr.XLogPos, err = ParseLSN(string(row[2]))
+	if err != nil {
+		return isr, fmt.Errorf("failed to parse xlogpos: %w", err)
+	}
+
+	isr.DBName = string(row[3])
+
+	return isr, nil
+}
+
+// ReplicationMode is the kind of replication performed by a replication slot or replication stream.
+type ReplicationMode int
+
+const (
+	// LogicalReplication streams changes decoded by an output plugin such as pgoutput.
+	LogicalReplication ReplicationMode = iota
+
+	// PhysicalReplication streams raw WAL.
+	PhysicalReplication
+)
+
+func (mode ReplicationMode) String() string {
+	switch mode {
+	case LogicalReplication:
+		return "LOGICAL"
+	case PhysicalReplication:
+		return "PHYSICAL"
+	default:
+		return fmt.Sprintf("ReplicationMode(%d)", int(mode))
+	}
+}
+
+// CreateReplicationSlotOptions are the options for the CREATE_REPLICATION_SLOT command.
+type CreateReplicationSlotOptions struct {
+	// Temporary slots are not saved to disk and are automatically dropped on error or when the session has finished.
+	Temporary bool
+
+	// SnapshotAction is one of "EXPORT_SNAPSHOT", "NOEXPORT_SNAPSHOT", or "USE_SNAPSHOT". If empty the server default
+	// is used. It only applies to logical replication slots.
+	SnapshotAction string
+
+	// Mode is the kind of replication slot to create. The default is LogicalReplication.
+	Mode ReplicationMode
+
+	// ReserveWAL causes a physical replication slot to reserve WAL immediately instead of when a client first connects
+	// to it.
+	ReserveWAL bool
+}
+
+// CreateReplicationSlotResult is the parsed result of the CREATE_REPLICATION_SLOT command.
+type CreateReplicationSlotResult struct {
+	SlotName        string
+	ConsistentPoint LSN    // WAL location at which the slot became consistent
+	SnapshotName    string // identifier of the snapshot exported by the command
+	OutputPlugin    string
+}
+
+// CreateReplicationSlot creates a replication slot named slotName. For a logical replication slot changes are decoded
+// with outputPlugin (e.g. "pgoutput"). outputPlugin is ignored for a physical replication slot.
+func CreateReplicationSlot(
+	ctx context.Context,
+	conn *pgconn.PgConn,
+	slotName string,
+	outputPlugin string,
+	options CreateReplicationSlotOptions,
+) (CreateReplicationSlotResult, error) {
+	var temporaryString string
+	if options.Temporary {
+		temporaryString = " TEMPORARY"
+	}
+
+	var sql string
+	switch options.Mode {
+	case LogicalReplication:
+		var snapshotString string
+		if options.SnapshotAction != "" {
+			snapshotString = " " + options.SnapshotAction
+		}
+		sql = fmt.Sprintf("CREATE_REPLICATION_SLOT %s%s LOGICAL %s%s",
+			quoteIdentifier(slotName), temporaryString, quoteIdentifier(outputPlugin), snapshotString)
+	case PhysicalReplication:
+		var reserveWALString string
+		if options.ReserveWAL {
+			reserveWALString = " RESERVE_WAL"
+		}
+		sql = fmt.Sprintf("CREATE_REPLICATION_SLOT %s%s PHYSICAL%s", quoteIdentifier(slotName), temporaryString, reserveWALString)
+	default:
+		return CreateReplicationSlotResult{}, fmt.Errorf("unknown replication mode: %v", options.Mode)
+	}
+
+	return ParseCreateReplicationSlot(conn.Exec(ctx, sql))
+}
+
+// ParseCreateReplicationSlot parses the result of the CREATE_REPLICATION_SLOT command.
+func ParseCreateReplicationSlot(mrr *pgconn.MultiResultReader) (CreateReplicationSlotResult, error) {
+	var crsr CreateReplicationSlotResult
+	results, err := mrr.ReadAll()
+	if err != nil {
+		return crsr, err
+	}
+
+	if len(results) != 1 {
+		return crsr, fmt.Errorf("expected 1 result set, got %d", len(results))
+	}
+
+	result := results[0]
+	if len(result.Rows) != 1 {
+		return crsr, fmt.Errorf("expected 1 result row, got %d", len(result.Rows))
+	}
+
+	row := result.Rows[0]
+	if len(row) != 4 {
+		return crsr, fmt.Errorf("expected 4 result columns, got %d", len(row))
+	}
+
+	crsr.SlotName = string(row[0])
+	// consistent_point is NULL for a physical replication slot that does not reserve WAL.
+	if row[1] != nil {
+		crsr.ConsistentPoint, err = ParseLSN(string(row[1]))
+		if err != nil {
+			return crsr, fmt.Errorf("failed to parse consistent_point: %w", err)
+		}
+	}
+	crsr.SnapshotName = string(row[2])
+	crsr.OutputPlugin = string(row[3])
+
+	return crsr, nil
+}
+
+// DropReplicationSlotOptions are the options for the DROP_REPLICATION_SLOT command.
+type DropReplicationSlotOptions struct {
+	// Wait causes the command to wait until the slot becomes inactive if it is currently in use instead of failing.
+	Wait bool
+}
+
+// DropReplicationSlot drops the replication slot named slotName.
+func DropReplicationSlot(ctx context.Context, conn *pgconn.PgConn, slotName string, options DropReplicationSlotOptions) error {
+	sql := "DROP_REPLICATION_SLOT " + quoteIdentifier(slotName)
+	if options.Wait {
+		sql += " WAIT"
+	}
+
+	_, err := conn.Exec(ctx, sql).ReadAll()
+	return err
+}
+
+// StartReplicationOptions are the options for the START_REPLICATION command.
+type StartReplicationOptions struct {
+	// PluginArgs are passed to the output plugin of a logical replication slot. Each argument must be a complete option
+	// such as "proto_version '1'". For pgoutput proto_version and publication_names are required.
+	PluginArgs []string
+
+	// Mode is the kind of replication to start. The default is LogicalReplication.
+	Mode ReplicationMode
+
+	// Timeline is the timeline to stream for physical replication. If 0 the current timeline of the server is used.
+	Timeline int32
+}
+
+// StartReplication begins streaming from the replication slot named slotName beginning at startLSN. slotName may be
+// empty for physical replication without a slot. On success the connection is in copy both mode. Messages should be
+// received with conn.ReceiveMessage, and the contents of each *pgproto3.CopyData parsed with ParseXLogData or
+// ParsePrimaryKeepaliveMessage according to its first byte.
+func StartReplication(ctx context.Context, conn *pgconn.PgConn, slotName string, startLSN LSN, options StartReplicationOptions) error {
+	var sql string
+	switch options.Mode {
+	case LogicalReplication:
+		sql = fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s", quoteIdentifier(slotName), startLSN)
+		if len(options.PluginArgs) > 0 {
+			sql += " (" + strings.Join(options.PluginArgs, ", ") + ")"
+		}
+	case PhysicalReplication:
+		sql = "START_REPLICATION"
+		if slotName != "" {
+			sql += " SLOT " + quoteIdentifier(slotName)
+		}
+		sql += fmt.Sprintf(" PHYSICAL %s", startLSN)
+		if options.Timeline > 0 {
+			sql += fmt.Sprintf(" TIMELINE %d", options.Timeline)
+		}
+	default:
+		return fmt.Errorf("unknown replication mode: %v", options.Mode)
+	}
+
+	return startCopyBoth(ctx, conn, sql)
+}
+
+// startCopyBoth sends sql and waits until the server switches the connection to copy both mode.
+func startCopyBoth(ctx context.Context, conn *pgconn.PgConn, sql string) error {
+	conn.Frontend().SendQuery(&pgproto3.Query{String: sql})
+	err := conn.Frontend().Flush()
+	if err != nil {
+		return fmt.Errorf("failed to send query: %w", err)
+	}
+
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to receive message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.NoticeResponse:
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyBothResponse:
+			// This signals the start of the replication stream.
+			return nil
+		default:
+			return fmt.Errorf("unexpected response type: %T", msg)
+		}
+	}
+}
+
+// PrimaryKeepaliveMessage is sent by the server periodically during streaming replication.
+type PrimaryKeepaliveMessage struct {
+	ServerWALEnd   LSN       // current end of WAL on the server
+	ServerTime     time.Time // server's system clock at the time of transmission
+	ReplyRequested bool      // the client should reply to this message as soon as possible
+}
+
+// ParsePrimaryKeepaliveMessage parses a primary keepalive message. buf is the contents of a CopyData message without
+// the leading PrimaryKeepaliveMessageByteID.
+func ParsePrimaryKeepaliveMessage(buf []byte) (PrimaryKeepaliveMessage, error) {
+	var pkm PrimaryKeepaliveMessage
+	if len(buf) != 17 {
+		return pkm, fmt.Errorf("PrimaryKeepaliveMessage must be 17 bytes, got %d", len(buf))
+	}
+
+	pkm.ServerWALEnd = LSN(binary.BigEndian.Uint64(buf))
+	pkm.ServerTime = pgTimeToTime(int64(binary.BigEndian.Uint64(buf[8:])))
+	pkm.ReplyRequested = buf[16] != 0
+
+	return pkm, nil
+}
+
+// XLogData is a chunk of WAL data sent by the server during streaming replication. For logical replication WALData
+// contains a single message of the output plugin.
+type XLogData struct {
+	WALStart     LSN       // starting point of the WAL data in this message
+	ServerWALEnd LSN       // current end of WAL on the server
+	ServerTime   time.Time // server's system clock at the time of transmission
+	WALData      []byte
+}
+
+// ParseXLogData parses an XLogData message. buf is the contents of a CopyData message without the leading
+// XLogDataByteID. WALData references buf.
+func ParseXLogData(buf []byte) (XLogData, error) {
+	var xld XLogData
+	if len(buf) < 24 {
+		return xld, fmt.Errorf("XLogData must be at least 24 bytes, got %d", len(buf))
+	}
+
+	xld.WALStart = LSN(binary.BigEndian.Uint64(buf))
+	xld.ServerWALEnd = LSN(binary.BigEndian.Uint64(buf[8:]))
+	xld.ServerTime = pgTimeToTime(int64(binary.BigEndian.Uint64(buf[16:])))
+	xld.WALData = buf[24:]
+
+	return xld, nil
+}
+
+// StandbyStatusUpdate reports the replication progress of the client to the server.
+type StandbyStatusUpdate struct {
+	WALWritePosition LSN       // last WAL byte + 1 received and written to disk locally
+	WALFlushPosition LSN       // last WAL byte + 1 flushed to disk locally. If 0, WALWritePosition is used.
+	WALApplyPosition LSN       // last WAL byte + 1 applied locally. If 0, WALWritePosition is used.
+	ClientTime       time.Time // client's system clock at the time of transmission. If zero, time.Now() is used.
+	ReplyRequested   bool      // request the server to reply to this message immediately
+}
+
+// Encode appends the encoded standby status update to dst. It does not include the CopyData message framing.
+func (ssu StandbyStatusUpdate) Encode(dst []byte) []byte {
+	if ssu.WALFlushPosition == 0 {
+		ssu.WALFlushPosition = ssu.WALWritePosition
+	}
+	if ssu.WALApplyPosition == 0 {
+		ssu.WALApplyPosition = ssu.WALWritePosition
+	}
+	if ssu.ClientTime.IsZero() {
+		ssu.ClientTime = time.Now()
+	}
+
+	dst = append(dst, StandbyStatusUpdateByteID)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(ssu.WALWritePosition))
+	dst = binary.BigEndian.AppendUint64(dst, uint64(ssu.WALFlushPosition))
+	dst = binary.BigEndian.AppendUint64(dst, uint64(ssu.WALApplyPosition))
+	dst = binary.BigEndian.AppendUint64(dst, uint64(timeToPgTime(ssu.ClientTime)))
+	if ssu.ReplyRequested {
+		dst = append(dst, 1)
+	} else {
+		dst = append(dst, 0)
+	}
+
+	return dst
+}
+
+// SendStandbyStatusUpdate sends a standby status update to the server. It must only be called while the connection is
+// in copy both mode.
+func SendStandbyStatusUpdate(ctx context.Context, conn *pgconn.PgConn, ssu StandbyStatusUpdate) error {
+	return sendCopyData(ctx, conn, ssu.Encode(nil))
+}
+
+// sendCopyData sends data in a CopyData message. The deadline of ctx, if any, is applied to the write.
+func sendCopyData(ctx context.Context, conn *pgconn.PgConn, data []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		err := conn.Conn().SetWriteDeadline(deadline)
+		if err != nil {
+			return err
+		}
+		defer conn.Conn().SetWriteDeadline(time.Time{})
+	}
+
+	conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	return conn.Frontend().Flush()
+}
+
+// CopyDoneResult is the result of ending the replication stream with SendStandbyCopyDone. Timeline and LSN are only
+// set when the server reports a timeline switch at the end of physical replication.
+type CopyDoneResult struct {
+	Timeline int32
+	LSN      LSN
+}
+
+// SendStandbyCopyDone ends the replication stream by sending CopyDone to the server. It reads and discards any
+// replication messages still in flight and returns once the connection is ready for a new command.
+func SendStandbyCopyDone(ctx context.Context, conn *pgconn.PgConn) (*CopyDoneResult, error) {
+	conn.Frontend().Send(&pgproto3.CopyDone{})
+	err := conn.Frontend().Flush()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send CopyDone: %w", err)
+	}
+
+	result := &CopyDoneResult{}
+	var pgErr error
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.DataRow:
+			// Result set with the next timeline and the position at which it starts.
+			if len(msg.Values) == 2 {
+				timeline, err := strconv.ParseInt(string(msg.Values[0]), 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse timeline: %w", err)
+				}
+				result.Timeline = int32(timeline)
+				result.LSN, err = ParseLSN(string(msg.Values[1]))
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse timeline start position: %w", err)
+				}
+			}
+		case *pgproto3.ErrorResponse:
+			pgErr = pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.ReadyForQuery:
+			if pgErr != nil {
+				return nil, pgErr
+			}
+			return result, nil
+		}
+	}
+}
+
+func pgTimeToTime(microsecSinceY2K int64) time.Time {
+	microsecSinceUnixEpoch := microsecFromUnixEpochToY2K + microsecSinceY2K
+	return time.Unix(0, microsecSinceUnixEpoch*1000)
+}
+
+func timeToPgTime(t time.Time) int64 {
+	microsecSinceUnixEpoch := t.Unix()*1000000 + int64(t.Nanosecond())/1000
+	return microsecSinceUnixEpoch - microsecFromUnixEpochToY2K
+}
+
+// quoteIdentifier quotes s as a replication command identifier.
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
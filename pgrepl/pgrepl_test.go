@@ -0,0 +1,316 @@
+package pgrepl_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectMock starts a mock server that runs steps after accepting an unauthenticated connection and returns a
+// connection to it.
+func connectMock(t *testing.T, steps ...pgmock.Step) (*pgconn.PgConn, chan error) {
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()}
+	script.Steps = append(script.Steps, steps...)
+	return connectMockScript(t, script)
+}
+
+// connectMockScript starts a mock server that runs script and returns a connection to it.
+func connectMockScript(t *testing.T, script *pgmock.Script) (*pgconn.PgConn, chan error) {
+	ln, serverErrChan, err := pgmock.Serve(script)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	connStr := fmt.Sprintf("sslmode=disable host=%s port=%s replication=database", host, port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := pgconn.Connect(ctx, connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	return conn, serverErrChan
+}
+
+func TestLSN(t *testing.T) {
+	t.Parallel()
+
+	lsn, err := pgrepl.ParseLSN("16/B374D848")
+	require.NoError(t, err)
+	assert.Equal(t, pgrepl.LSN(0x16B374D848), lsn)
+	assert.Equal(t, "16/B374D848", lsn.String())
+
+	assert.Equal(t, "0/0", pgrepl.LSN(0).String())
+
+	for _, s := range []string{"", "16", "16/", "/B374D848", "XX/B374D848", "1FFFFFFFF/0"} {
+		_, err := pgrepl.ParseLSN(s)
+		assert.Errorf(t, err, "%q", s)
+	}
+
+	var scanned pgrepl.LSN
+	require.NoError(t, scanned.Scan("1/2"))
+	assert.Equal(t, pgrepl.LSN(1<<32|2), scanned)
+	require.NoError(t, scanned.Scan([]byte("3/4")))
+	assert.Equal(t, pgrepl.LSN(3<<32|4), scanned)
+	require.Error(t, scanned.Scan(nil))
+
+	v, err := scanned.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "3/4", v)
+}
+
+func TestIdentifySystem(t *testing.T) {
+	t.Parallel()
+
+	conn, serverErrChan := connectMock(t,
+		pgmock.ExpectMessage(&pgproto3.Query{String: "IDENTIFY_SYSTEM"}),
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("systemid"), DataTypeOID: 25},
+			{Name: []byte("timeline"), DataTypeOID: 23},
+			{Name: []byte("xlogpos"), DataTypeOID: 25},
+			{Name: []byte("dbname"), DataTypeOID: 25},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{
+			[]byte("7165487301839245325"), []byte("1"), []byte("0/1745A58"), []byte("postgres"),
+		}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("IDENTIFY_SYSTEM")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	isr, err := pgrepl.IdentifySystem(ctx, conn)
+	require.NoError(t, err)
+	assert.Equal(t, "7165487301839245325", isr.SystemID)
+	assert.Equal(t, int32(1), isr.Timeline)
+	assert.Equal(t, pgrepl.LSN(0x1745A58), isr.XLogPos)
+	assert.Equal(t, "postgres", isr.DBName)
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestCreateAndDropReplicationSlot(t *testing.T) {
+	t.Parallel()
+
+	conn, serverErrChan := connectMock(t,
+		pgmock.ExpectMessage(&pgproto3.Query{String: `CREATE_REPLICATION_SLOT "my_slot" TEMPORARY LOGICAL "pgoutput" NOEXPORT_SNAPSHOT`}),
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("slot_name"), DataTypeOID: 25},
+			{Name: []byte("consistent_point"), DataTypeOID: 25},
+			{Name: []byte("snapshot_name"), DataTypeOID: 25},
+			{Name: []byte("output_plugin"), DataTypeOID: 25},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{
+			[]byte("my_slot"), []byte("0/1745A90"), nil, []byte("pgoutput"),
+		}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("CREATE_REPLICATION_SLOT")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+
+		pgmock.ExpectMessage(&pgproto3.Query{String: `DROP_REPLICATION_SLOT "my_slot" WAIT`}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("DROP_REPLICATION_SLOT")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	crsr, err := pgrepl.CreateReplicationSlot(ctx, conn, "my_slot", "pgoutput", pgrepl.CreateReplicationSlotOptions{
+		Temporary:      true,
+		SnapshotAction: "NOEXPORT_SNAPSHOT",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "my_slot", crsr.SlotName)
+	assert.Equal(t, pgrepl.LSN(0x1745A90), crsr.ConsistentPoint)
+	assert.Equal(t, "", crsr.SnapshotName)
+	assert.Equal(t, "pgoutput", crsr.OutputPlugin)
+
+	err = pgrepl.DropReplicationSlot(ctx, conn, "my_slot", pgrepl.DropReplicationSlotOptions{Wait: true})
+	require.NoError(t, err)
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestStartReplication(t *testing.T) {
+	t.Parallel()
+
+	serverTime := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	pgServerTime := uint64(serverTime.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Microseconds())
+
+	xld := []byte{pgrepl.XLogDataByteID}
+	xld = binary.BigEndian.AppendUint64(xld, 0x100)
+	xld = binary.BigEndian.AppendUint64(xld, 0x200)
+	xld = binary.BigEndian.AppendUint64(xld, pgServerTime)
+	xld = append(xld, "B..."...)
+
+	pkm := []byte{pgrepl.PrimaryKeepaliveMessageByteID}
+	pkm = binary.BigEndian.AppendUint64(pkm, 0x300)
+	pkm = binary.BigEndian.AppendUint64(pkm, pgServerTime)
+	pkm = append(pkm, 1)
+
+	ssu := pgrepl.StandbyStatusUpdate{WALWritePosition: 0x300, ClientTime: serverTime}
+
+	conn, serverErrChan := connectMock(t,
+		pgmock.ExpectMessage(&pgproto3.Query{String: `START_REPLICATION SLOT "my_slot" LOGICAL 0/100 (proto_version '1', publication_names 'pub')`}),
+		pgmock.SendMessage(&pgproto3.CopyBothResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: xld}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: pkm}),
+		pgmock.ExpectMessage(&pgproto3.CopyData{Data: ssu.Encode(nil)}),
+		pgmock.ExpectMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("START_REPLICATION")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := pgrepl.StartReplication(ctx, conn, "my_slot", 0x100, pgrepl.StartReplicationOptions{
+		PluginArgs: []string{"proto_version '1'", "publication_names 'pub'"},
+	})
+	require.NoError(t, err)
+
+	msg, err := conn.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	cd, ok := msg.(*pgproto3.CopyData)
+	require.True(t, ok)
+	require.Equal(t, byte(pgrepl.XLogDataByteID), cd.Data[0])
+	xlogData, err := pgrepl.ParseXLogData(cd.Data[1:])
+	require.NoError(t, err)
+	assert.Equal(t, pgrepl.LSN(0x100), xlogData.WALStart)
+	assert.Equal(t, pgrepl.LSN(0x200), xlogData.ServerWALEnd)
+	assert.True(t, serverTime.Equal(xlogData.ServerTime))
+	assert.Equal(t, []byte("B..."), xlogData.WALData)
+
+	msg, err = conn.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	cd, ok = msg.(*pgproto3.CopyData)
+	require.True(t, ok)
+	require.Equal(t, byte(pgrepl.PrimaryKeepaliveMessageByteID), cd.Data[0])
+	keepalive, err := pgrepl.ParsePrimaryKeepaliveMessage(cd.Data[1:])
+	require.NoError(t, err)
+	assert.Equal(t, pgrepl.LSN(0x300), keepalive.ServerWALEnd)
+	assert.True(t, serverTime.Equal(keepalive.ServerTime))
+	assert.True(t, keepalive.ReplyRequested)
+
+	err = pgrepl.SendStandbyStatusUpdate(ctx, conn, ssu)
+	require.NoError(t, err)
+
+	_, err = pgrepl.SendStandbyCopyDone(ctx, conn)
+	require.NoError(t, err)
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestPhysicalReplication(t *testing.T) {
+	t.Parallel()
+
+	xld := []byte{pgrepl.XLogDataByteID}
+	xld = binary.BigEndian.AppendUint64(xld, 0x1000000)
+	xld = binary.BigEndian.AppendUint64(xld, 0x1000004)
+	xld = binary.BigEndian.AppendUint64(xld, 0)
+	xld = append(xld, "WAL!"...)
+
+	conn, serverErrChan := connectMock(t,
+		pgmock.ExpectMessage(&pgproto3.Query{String: `CREATE_REPLICATION_SLOT "standby" PHYSICAL RESERVE_WAL`}),
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("slot_name"), DataTypeOID: 25},
+			{Name: []byte("consistent_point"), DataTypeOID: 25},
+			{Name: []byte("snapshot_name"), DataTypeOID: 25},
+			{Name: []byte("output_plugin"), DataTypeOID: 25},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("standby"), []byte("0/1000000"), nil, nil}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("CREATE_REPLICATION_SLOT")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+
+		pgmock.ExpectMessage(&pgproto3.Query{String: `START_REPLICATION SLOT "standby" PHYSICAL 0/1000000 TIMELINE 1`}),
+		pgmock.SendMessage(&pgproto3.CopyBothResponse{OverallFormat: 0, ColumnFormatCodes: []uint16{}}),
+		pgmock.SendMessage(&pgproto3.CopyData{Data: xld}),
+		pgmock.ExpectMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.CopyDone{}),
+		pgmock.SendMessage(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("next_tli"), DataTypeOID: 20},
+			{Name: []byte("next_tli_startpos"), DataTypeOID: 25},
+		}}),
+		pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{[]byte("2"), []byte("0/1000004")}}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("START_STREAMING")}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	crsr, err := pgrepl.CreateReplicationSlot(ctx, conn, "standby", "", pgrepl.CreateReplicationSlotOptions{
+		Mode:       pgrepl.PhysicalReplication,
+		ReserveWAL: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "standby", crsr.SlotName)
+	assert.Equal(t, pgrepl.LSN(0x1000000), crsr.ConsistentPoint)
+
+	err = pgrepl.StartReplication(ctx, conn, "standby", crsr.ConsistentPoint, pgrepl.StartReplicationOptions{
+		Mode:     pgrepl.PhysicalReplication,
+		Timeline: 1,
+	})
+	require.NoError(t, err)
+
+	msg, err := conn.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	cd, ok := msg.(*pgproto3.CopyData)
+	require.True(t, ok)
+	require.Equal(t, byte(pgrepl.XLogDataByteID), cd.Data[0])
+	xlogData, err := pgrepl.ParseXLogData(cd.Data[1:])
+	require.NoError(t, err)
+	assert.Equal(t, pgrepl.LSN(0x1000000), xlogData.WALStart)
+	assert.Equal(t, []byte("WAL!"), xlogData.WALData)
+
+	cdr, err := pgrepl.SendStandbyCopyDone(ctx, conn)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), cdr.Timeline)
+	assert.Equal(t, pgrepl.LSN(0x1000004), cdr.LSN)
+
+	conn.Close(ctx)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestStartReplicationError(t *testing.T) {
+	t.Parallel()
+
+	conn, _ := connectMock(t,
+		pgmock.ExpectAnyMessage(&pgproto3.Query{}),
+		pgmock.SendMessage(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42704", Message: `replication slot "missing" does not exist`}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := pgrepl.StartReplication(ctx, conn, "missing", 0, pgrepl.StartReplicationOptions{})
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "42704", pgErr.Code)
+}
+
+func TestParseMessagesInvalidLength(t *testing.T) {
+	t.Parallel()
+
+	_, err := pgrepl.ParseXLogData(make([]byte, 23))
+	require.Error(t, err)
+
+	_, err = pgrepl.ParsePrimaryKeepaliveMessage(make([]byte, 16))
+	require.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package pgrepl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultWALSegmentSize is the default size of a WAL segment file. The actual size is set by the wal_segment_size
+// setting of the server.
+const DefaultWALSegmentSize = 16 * 1024 * 1024
+
+// WALSegmentName returns the file name of the WAL segment on timeline that contains lsn (e.g.
+// 000000010000000000000001).
+func WALSegmentName(timeline int32, lsn LSN, segmentSize uint64) string {
+	segmentNumber := uint64(lsn) / segmentSize
+	segmentsPerXLogID := 0x100000000 / segmentSize
+	return fmt.Sprintf("%08X%08X%08X", uint32(timeline), uint32(segmentNumber/segmentsPerXLogID), uint32(segmentNumber%segmentsPerXLogID))
+}
+
+// WALSegmentWriter writes the WAL received during physical replication into segment files in the same way as
+// pg_receivewal. Each segment is written to the io.WriteCloser returned by Open which is closed once the segment is
+// complete.
+type WALSegmentWriter struct {
+	// Timeline is the timeline of the WAL. It is used to name the segments.
+	Timeline int32
+
+	// SegmentSize is the size of a WAL segment. If 0, DefaultWALSegmentSize is used.
+	SegmentSize uint64
+
+	// Open is called with the name of each segment before its first byte is written. It is required.
+	Open func(name string) (io.WriteCloser, error)
+
+	segment io.WriteCloser
+	pos     LSN
+}
+
+// Write writes the WAL data of xld. The first call must start at a segment boundary. Each subsequent call must
+// continue exactly where the previous one ended.
+func (w *WALSegmentWriter) Write(xld XLogData) error {
+	if w.Open == nil {
+		return errors.New("WALSegmentWriter.Open is required")
+	}
+
+	segmentSize := w.segmentSize()
+	if w.pos == 0 {
+		if uint64(xld.WALStart)%segmentSize != 0 {
+			return fmt.Errorf("WAL must start at a segment boundary, got %s", xld.WALStart)
+		}
+	} else if xld.WALStart != w.pos {
+		return fmt.Errorf("WAL is not contiguous: expected %s, got %s", w.pos, xld.WALStart)
+	}
+	w.pos = xld.WALStart
+
+	data := xld.WALData
+	for len(data) > 0 {
+		if w.segment == nil {
+			segment, err := w.Open(WALSegmentName(w.Timeline, w.pos, segmentSize))
+			if err != nil {
+				return err
+			}
+			w.segment = segment
+		}
+
+		n := segmentSize - uint64(w.pos)%segmentSize
+		if uint64(len(data)) < n {
+			n = uint64(len(data))
+		}
+
+		_, err := w.segment.Write(data[:n])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		w.pos += LSN(n)
+
+		if uint64(w.pos)%segmentSize == 0 {
+			err := w.segment.Close()
+			w.segment = nil
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Position returns the position up to which WAL has been written. It is suitable as WALWritePosition of a
+// StandbyStatusUpdate.
+func (w *WALSegmentWriter) Position() LSN {
+	return w.pos
+}
+
+// Close closes the current partial segment, if any.
+func (w *WALSegmentWriter) Close() error {
+	if w.segment == nil {
+		return nil
+	}
+
+	err := w.segment.Close()
+	w.segment = nil
+	return err
+}
+
+func (w *WALSegmentWriter) segmentSize() uint64 {
+	if w.SegmentSize == 0 {
+		return DefaultWALSegmentSize
+	}
+	return w.SegmentSize
+}
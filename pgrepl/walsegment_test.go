@@ -0,0 +1,75 @@
+package pgrepl_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgrepl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALSegmentName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "000000010000000000000001", pgrepl.WALSegmentName(1, 0x1000028, pgrepl.DefaultWALSegmentSize))
+	assert.Equal(t, "000000020000000100000000", pgrepl.WALSegmentName(2, 0x100000000, pgrepl.DefaultWALSegmentSize))
+	assert.Equal(t, "0000000100000000000000FF", pgrepl.WALSegmentName(1, 0xFF000000, pgrepl.DefaultWALSegmentSize))
+	assert.Equal(t, "000000010000000000000003", pgrepl.WALSegmentName(1, 0xC00000, 4*1024*1024))
+}
+
+type segmentBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (sb *segmentBuffer) Close() error {
+	sb.closed = true
+	return nil
+}
+
+func TestWALSegmentWriter(t *testing.T) {
+	t.Parallel()
+
+	var names []string
+	var segments []*segmentBuffer
+	w := &pgrepl.WALSegmentWriter{
+		Timeline:    1,
+		SegmentSize: 4,
+		Open: func(name string) (io.WriteCloser, error) {
+			names = append(names, name)
+			sb := &segmentBuffer{}
+			segments = append(segments, sb)
+			return sb, nil
+		},
+	}
+
+	err := w.Write(pgrepl.XLogData{WALStart: 3, WALData: []byte("abc")})
+	require.Error(t, err)
+
+	require.NoError(t, w.Write(pgrepl.XLogData{WALStart: 4, WALData: []byte("abcdef")}))
+	require.NoError(t, w.Write(pgrepl.XLogData{WALStart: 10, WALData: []byte("gh")}))
+	require.NoError(t, w.Write(pgrepl.XLogData{WALStart: 12, WALData: []byte("i")}))
+	assert.Equal(t, pgrepl.LSN(13), w.Position())
+
+	err = w.Write(pgrepl.XLogData{WALStart: 20, WALData: []byte("z")})
+	require.Error(t, err)
+
+	require.Len(t, segments, 3)
+	assert.Equal(t, "abcd", segments[0].String())
+	assert.True(t, segments[0].closed)
+	assert.Equal(t, "efgh", segments[1].String())
+	assert.True(t, segments[1].closed)
+	assert.Equal(t, "i", segments[2].String())
+	assert.False(t, segments[2].closed)
+
+	require.NoError(t, w.Close())
+	assert.True(t, segments[2].closed)
+
+	assert.Equal(t, []string{
+		pgrepl.WALSegmentName(1, 4, 4),
+		pgrepl.WALSegmentName(1, 8, 4),
+		pgrepl.WALSegmentName(1, 12, 4),
+	}, names)
+}
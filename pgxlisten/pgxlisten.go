@@ -0,0 +1,377 @@
+// Package pgxlisten listens for PostgreSQL notifications on a dedicated connection and delivers them to Go channels.
+//
+// A Listener owns a single connection that is used only for LISTEN. Channels can be listened to and unlistened at any
+// time while the Listener is running. Each call to Listen returns a Subscription that receives the notifications for
+// its channel. Multiple subscriptions to the same channel each receive every notification. If the connection is lost
+// the Listener reconnects and listens to all subscribed channels again. Notifications sent while the Listener was
+// disconnected are lost.
+//
+//	listener := &pgxlisten.Listener{Connect: pgxlisten.PoolConnect(pool)}
+//	go listener.Run(ctx)
+//	sub, err := listener.Listen(ctx, "jobs")
+//	for n := range sub.Notifications() {
+//		fmt.Println(n.Payload)
+//	}
+package pgxlisten
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultReconnectDelay is the time to wait before reconnecting when Listener.ReconnectDelay is 0.
+const DefaultReconnectDelay = time.Second
+
+// DefaultBufferSize is the size of the notification buffer of a Subscription when Listener.BufferSize is 0.
+const DefaultBufferSize = 64
+
+// Listener listens for notifications on a dedicated connection. It must not be copied after first use.
+type Listener struct {
+	// Connect establishes the dedicated connection. It is called when Run starts and after the connection is lost. The
+	// Listener closes the connection when it is no longer used. PoolConnect can be used to take connections from a
+	// pgxpool.Pool.
+	Connect func(ctx context.Context) (*pgx.Conn, error)
+
+	// ReconnectDelay is the time to wait before reconnecting after the connection is lost or cannot be established. If
+	// it is 0 DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration
+
+	// BufferSize is the number of notifications buffered for each Subscription. If it is 0 DefaultBufferSize is used.
+	// When the buffer of a subscription is full delivery of notifications to all subscriptions waits until the
+	// subscription receives.
+	BufferSize int
+
+	// LogError is called with errors that cause the connection to be reestablished. If it is nil errors are ignored.
+	LogError func(ctx context.Context, err error)
+
+	mux           sync.Mutex
+	subscriptions map[string]map[*Subscription]struct{}
+	running       bool
+	pending       []chan error    // Listen calls waiting for the LISTEN to be executed
+	unlistened    []*Subscription // subscriptions to close by Run
+	wake          chan struct{}
+}
+
+// Subscription receives the notifications for a channel. It is created by Listener.Listen.
+type Subscription struct {
+	channel       string
+	notifications chan *pgconn.Notification
+	done          chan struct{}
+}
+
+// Channel returns the name of the channel the subscription is for.
+func (s *Subscription) Channel() string {
+	return s.channel
+}
+
+// Notifications returns the Go channel that receives the notifications. It is closed after Listener.Unlisten is called
+// with the subscription or when Listener.Run returns.
+func (s *Subscription) Notifications() <-chan *pgconn.Notification {
+	return s.notifications
+}
+
+// PoolConnect returns a function for Listener.Connect that acquires a connection from pool and removes it from the
+// pool. The pool is free to establish a replacement connection.
+func PoolConnect(pool *pgxpool.Pool) func(ctx context.Context) (*pgx.Conn, error) {
+	return func(ctx context.Context) (*pgx.Conn, error) {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.Hijack(), nil
+	}
+}
+
+func (l *Listener) init() {
+	if l.subscriptions == nil {
+		l.subscriptions = make(map[string]map[*Subscription]struct{})
+		l.wake = make(chan struct{}, 1)
+	}
+}
+
+// signal wakes Run to process changes. l.mux must be held.
+func (l *Listener) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Listen subscribes to channel. It waits until the server is listening to channel. If Run is not connected Listen waits
+// until Run connects and listens to channel. If ctx is done first the subscription is removed and ctx.Err() is
+// returned. If Run returns first an error is returned.
+func (l *Listener) Listen(ctx context.Context, channel string) (*Subscription, error) {
+	bufferSize := l.BufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultBufferSize
+	}
+	sub := &Subscription{
+		channel:       channel,
+		notifications: make(chan *pgconn.Notification, bufferSize),
+		done:          make(chan struct{}),
+	}
+
+	l.mux.Lock()
+	l.init()
+	if l.subscriptions[channel] == nil {
+		l.subscriptions[channel] = make(map[*Subscription]struct{})
+	}
+	l.subscriptions[channel][sub] = struct{}{}
+
+	listened := make(chan error, 1)
+	l.pending = append(l.pending, listened)
+	l.signal()
+	l.mux.Unlock()
+
+	var err error
+	select {
+	case err = <-listened:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		l.Unlisten(sub)
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// Unlisten removes sub. Its notification channel is closed. If sub was the last subscription to its channel the
+// Listener stops listening to the channel.
+func (l *Listener) Unlisten(sub *Subscription) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.init()
+
+	subs, ok := l.subscriptions[sub.channel]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(l.subscriptions, sub.channel)
+	}
+	close(sub.done)
+
+	// Only Run sends notifications so only Run can safely close the channel while it is running.
+	if l.running {
+		l.unlistened = append(l.unlistened, sub)
+		l.signal()
+	} else {
+		close(sub.notifications)
+	}
+}
+
+// Run connects and delivers notifications to subscriptions until ctx is canceled. It reconnects when the connection is
+// lost. When Run returns all subscriptions are removed and their notification channels are closed. Run always returns
+// a non-nil error. Only one Run may be active at a time.
+func (l *Listener) Run(ctx context.Context) error {
+	if l.Connect == nil {
+		return errors.New("pgxlisten: Connect is nil")
+	}
+
+	l.mux.Lock()
+	l.init()
+	if l.running {
+		l.mux.Unlock()
+		return errors.New("pgxlisten: Run is already active")
+	}
+	l.running = true
+	l.mux.Unlock()
+
+	defer func() {
+		l.mux.Lock()
+		l.running = false
+		l.closeUnlistened()
+		l.closeSubscriptions()
+		l.mux.Unlock()
+	}()
+
+	reconnectDelay := l.ReconnectDelay
+	if reconnectDelay == 0 {
+		reconnectDelay = DefaultReconnectDelay
+	}
+
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if l.LogError != nil {
+			l.LogError(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// closeUnlistened closes the notification channels of unlistened subscriptions. l.mux must be held.
+func (l *Listener) closeUnlistened() {
+	for _, sub := range l.unlistened {
+		close(sub.notifications)
+	}
+	l.unlistened = nil
+}
+
+// closeSubscriptions removes all subscriptions and closes their notification channels. Pending Listen calls fail. l.mux
+// must be held.
+func (l *Listener) closeSubscriptions() {
+	for channel, subs := range l.subscriptions {
+		for sub := range subs {
+			close(sub.done)
+			close(sub.notifications)
+		}
+		delete(l.subscriptions, channel)
+	}
+
+	for _, listened := range l.pending {
+		listened <- errors.New("pgxlisten: Run returned")
+	}
+	l.pending = nil
+}
+
+// listen uses one connection until it fails.
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("pgxlisten: connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	listening := make(map[string]struct{})
+	for {
+		err := l.sync(ctx, conn, listening)
+		if err != nil {
+			return err
+		}
+
+		// Run is woken by a read deadline in the past instead of canceling the context of WaitForNotification. Canceling
+		// it could send a cancel request to the server that interrupts the next LISTEN or UNLISTEN.
+		netConn := conn.PgConn().Conn()
+		woken := false
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-l.wake:
+				woken = true
+				netConn.SetReadDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+		notification, err := conn.WaitForNotification(ctx)
+		close(stop)
+		// A wake consumed after WaitForNotification returned is handled by the next sync.
+		<-stopped
+		if woken {
+			if deadlineErr := netConn.SetReadDeadline(time.Time{}); deadlineErr != nil {
+				return fmt.Errorf("pgxlisten: reset read deadline: %w", deadlineErr)
+			}
+			if err != nil && pgconn.Timeout(err) && ctx.Err() == nil && !conn.IsClosed() {
+				// Woken to process changes.
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("pgxlisten: wait for notification: %w", err)
+		}
+
+		err = l.deliver(ctx, notification)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sync listens and unlistens on conn so the channels in listening match the subscriptions.
+func (l *Listener) sync(ctx context.Context, conn *pgx.Conn, listening map[string]struct{}) error {
+	l.mux.Lock()
+	var toListen, toUnlisten []string
+	for channel := range l.subscriptions {
+		if _, ok := listening[channel]; !ok {
+			toListen = append(toListen, channel)
+		}
+	}
+	for channel := range listening {
+		if _, ok := l.subscriptions[channel]; !ok {
+			toUnlisten = append(toUnlisten, channel)
+		}
+	}
+	pending := l.pending
+	l.pending = nil
+	unlistened := l.unlistened
+	l.unlistened = nil
+	l.mux.Unlock()
+
+	var err error
+	for _, channel := range toListen {
+		_, err = conn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize())
+		if err != nil {
+			break
+		}
+		listening[channel] = struct{}{}
+	}
+	for _, channel := range toUnlisten {
+		if err != nil {
+			break
+		}
+		_, err = conn.Exec(ctx, "unlisten "+pgx.Identifier{channel}.Sanitize())
+		if err == nil {
+			delete(listening, channel)
+		}
+	}
+
+	if err != nil {
+		// Return pending Listen calls to the queue. They are completed after reconnecting.
+		l.mux.Lock()
+		l.pending = append(l.pending, pending...)
+		l.unlistened = append(l.unlistened, unlistened...)
+		l.mux.Unlock()
+		return fmt.Errorf("pgxlisten: %w", err)
+	}
+
+	for _, listened := range pending {
+		listened <- nil
+	}
+	for _, sub := range unlistened {
+		close(sub.notifications)
+	}
+	return nil
+}
+
+// deliver sends notification to each subscription to its channel.
+func (l *Listener) deliver(ctx context.Context, notification *pgconn.Notification) error {
+	l.mux.Lock()
+	subs := make([]*Subscription, 0, len(l.subscriptions[notification.Channel]))
+	for sub := range l.subscriptions[notification.Channel] {
+		subs = append(subs, sub)
+	}
+	l.mux.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.notifications <- notification:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package pgxlisten_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxlisten"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startMockServer starts a mock server that runs each script against a successively accepted connection. Cancel
+// requests, which are sent when a connection is lost, are ignored. It returns a connection string for the server.
+func startMockServer(t *testing.T, scripts ...*pgmock.Script) (string, chan error) {
+	ln, serverErrChan, err := pgmock.ServeIgnoringCancelRequests(scripts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	return fmt.Sprintf("sslmode=disable host=%s port=%s", host, port), serverErrChan
+}
+
+// commandSteps returns the steps of the server executing the simple protocol query sql.
+func commandSteps(sql, commandTag string) []pgmock.Step {
+	return []pgmock.Step{
+		pgmock.ExpectMessage(&pgproto3.Query{String: sql}),
+		pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte(commandTag)}),
+		pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+	}
+}
+
+func newScript(steps ...[]pgmock.Step) *pgmock.Script {
+	// The startup message is received by the mock server.
+	script := &pgmock.Script{Steps: pgmock.AcceptUnauthenticatedConnRequestSteps()[1:]}
+	for _, s := range steps {
+		script.Steps = append(script.Steps, s...)
+	}
+	return script
+}
+
+func notify(channel, payload string) []pgmock.Step {
+	return []pgmock.Step{pgmock.SendMessage(&pgproto3.NotificationResponse{PID: 42, Channel: channel, Payload: payload})}
+}
+
+func receive(t *testing.T, sub *pgxlisten.Subscription) *pgconn.Notification {
+	t.Helper()
+
+	select {
+	case n, ok := <-sub.Notifications():
+		require.True(t, ok, "notifications channel closed")
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+		return nil
+	}
+}
+
+// listenAsync calls listener.Listen in a goroutine. Listen waits until the listener is running and connected.
+func listenAsync(ctx context.Context, listener *pgxlisten.Listener, channel string) func(t *testing.T) *pgxlisten.Subscription {
+	type result struct {
+		sub *pgxlisten.Subscription
+		err error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		sub, err := listener.Listen(ctx, channel)
+		resultChan <- result{sub: sub, err: err}
+	}()
+
+	return func(t *testing.T) *pgxlisten.Subscription {
+		t.Helper()
+		select {
+		case r := <-resultChan:
+			require.NoError(t, r.err)
+			return r.sub
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for Listen")
+			return nil
+		}
+	}
+}
+
+func TestListenerReconnect(t *testing.T) {
+	t.Parallel()
+
+	connString, serverErrChan := startMockServer(t,
+		newScript(commandSteps(`listen "jobs"`, "LISTEN"), notify("jobs", "1")),
+		newScript(commandSteps(`listen "jobs"`, "LISTEN"), notify("jobs", "2"), []pgmock.Step{pgmock.ExpectMessage(&pgproto3.Terminate{})}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var loggedErrs []error
+	listener := &pgxlisten.Listener{
+		Connect:        func(ctx context.Context) (*pgx.Conn, error) { return pgx.Connect(ctx, connString) },
+		ReconnectDelay: 10 * time.Millisecond,
+		LogError:       func(ctx context.Context, err error) { loggedErrs = append(loggedErrs, err) },
+	}
+
+	waitListen := listenAsync(ctx, listener, "jobs")
+
+	runCtx, stopRun := context.WithCancel(ctx)
+	runErrChan := make(chan error)
+	go func() { runErrChan <- listener.Run(runCtx) }()
+
+	sub := waitListen(t)
+	assert.Equal(t, "jobs", sub.Channel())
+
+	n := receive(t, sub)
+	assert.Equal(t, "jobs", n.Channel)
+	assert.Equal(t, "1", n.Payload)
+	assert.EqualValues(t, 42, n.PID)
+	assert.Equal(t, "2", receive(t, sub).Payload)
+
+	stopRun()
+	require.ErrorIs(t, <-runErrChan, context.Canceled)
+	require.NoError(t, <-serverErrChan)
+	require.Len(t, loggedErrs, 1)
+
+	// The subscription is closed when Run returns.
+	_, ok := <-sub.Notifications()
+	require.False(t, ok)
+}
+
+func TestListenerListenWaitsForListenAfterReconnect(t *testing.T) {
+	t.Parallel()
+
+	connString, serverErrChan := startMockServer(t,
+		// The connection is lost before the LISTEN completes.
+		newScript([]pgmock.Step{pgmock.ExpectMessage(&pgproto3.Query{String: `listen "jobs"`})}),
+		newScript(commandSteps(`listen "jobs"`, "LISTEN"), notify("jobs", "1"), []pgmock.Step{pgmock.ExpectMessage(&pgproto3.Terminate{})}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	listenedChan := make(chan struct{})
+	listener := &pgxlisten.Listener{
+		Connect:        func(ctx context.Context) (*pgx.Conn, error) { return pgx.Connect(ctx, connString) },
+		ReconnectDelay: 10 * time.Millisecond,
+		LogError: func(ctx context.Context, err error) {
+			select {
+			case <-listenedChan:
+				t.Error("Listen returned before the server was listening")
+			default:
+			}
+		},
+	}
+
+	runCtx, stopRun := context.WithCancel(ctx)
+	runErrChan := make(chan error)
+	go func() { runErrChan <- listener.Run(runCtx) }()
+
+	sub, err := listener.Listen(ctx, "jobs")
+	require.NoError(t, err)
+	close(listenedChan)
+	assert.Equal(t, "1", receive(t, sub).Payload)
+
+	stopRun()
+	require.ErrorIs(t, <-runErrChan, context.Canceled)
+	require.NoError(t, <-serverErrChan)
+}
+
+func TestListenerListenIsCanceledByContext(t *testing.T) {
+	t.Parallel()
+
+	listener := &pgxlisten.Listener{
+		Connect: func(ctx context.Context) (*pgx.Conn, error) { return nil, errors.New("not used") },
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Run is not active so the server is never listening.
+	_, err := listener.Listen(ctx, "jobs")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// countingHandler counts the canceled contexts of a connection before passing them to a
+// CancelRequestContextWatcherHandler.
+type countingHandler struct {
+	*pgconn.CancelRequestContextWatcherHandler
+	canceled *atomic.Int32
+}
+
+func (h countingHandler) HandleCancel(canceledCtx context.Context) {
+	h.canceled.Add(1)
+	h.CancelRequestContextWatcherHandler.HandleCancel(canceledCtx)
+}
+
+func TestListenerListenAndUnlistenWhileRunning(t *testing.T) {
+	t.Parallel()
+
+	connString, serverErrChan := startMockServer(t, newScript(
+		commandSteps(`listen "a"`, "LISTEN"),
+		commandSteps(`listen "b"`, "LISTEN"),
+		notify("a", "a1"),
+		notify("b", "b1"),
+		commandSteps(`unlisten "a"`, "UNLISTEN"),
+		[]pgmock.Step{pgmock.ExpectMessage(&pgproto3.Terminate{})},
+	))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Waking Run for changes must not cancel a context. That would send a cancel request to the server.
+	var canceled atomic.Int32
+	listener := &pgxlisten.Listener{
+		Connect: func(ctx context.Context) (*pgx.Conn, error) {
+			config, err := pgx.ParseConfig(connString)
+			if err != nil {
+				return nil, err
+			}
+			config.BuildContextWatcherHandler = func(pgConn *pgconn.PgConn) ctxwatch.Handler {
+				return countingHandler{&pgconn.CancelRequestContextWatcherHandler{Conn: pgConn}, &canceled}
+			}
+			return pgx.ConnectConfig(ctx, config)
+		},
+	}
+
+	runCtx, stopRun := context.WithCancel(ctx)
+	runErrChan := make(chan error)
+	go func() { runErrChan <- listener.Run(runCtx) }()
+
+	// Listen waits until the server is listening. The second subscription to a channel does not LISTEN again.
+	subA1, err := listener.Listen(ctx, "a")
+	require.NoError(t, err)
+	subA2, err := listener.Listen(ctx, "a")
+	require.NoError(t, err)
+	subB, err := listener.Listen(ctx, "b")
+	require.NoError(t, err)
+
+	assert.Equal(t, "a1", receive(t, subA1).Payload)
+	assert.Equal(t, "a1", receive(t, subA2).Payload)
+	assert.Equal(t, "b1", receive(t, subB).Payload)
+
+	// The channel is listened to until its last subscription is removed.
+	listener.Unlisten(subA1)
+	listener.Unlisten(subA2)
+	for range subA1.Notifications() {
+	}
+	for range subA2.Notifications() {
+	}
+	assert.EqualValues(t, 0, canceled.Load())
+
+	stopRun()
+	require.ErrorIs(t, <-runErrChan, context.Canceled)
+	require.NoError(t, <-serverErrChan)
+
+	// Run closes the notification channels of the remaining subscriptions when it returns.
+	_, ok := <-subB.Notifications()
+	require.False(t, ok)
+	listener.Unlisten(subB)
+}
+
+func TestListenerPool(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, os.Getenv("PGX_TEST_DATABASE"))
+	require.NoError(t, err)
+	defer pool.Close()
+	require.NoError(t, pool.Ping(ctx))
+
+	listener := &pgxlisten.Listener{Connect: pgxlisten.PoolConnect(pool)}
+
+	runCtx, stopRun := context.WithCancel(ctx)
+	runErrChan := make(chan error)
+	go func() { runErrChan <- listener.Run(runCtx) }()
+
+	sub, err := listener.Listen(ctx, "pgxlisten test")
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, "select pg_notify($1, $2)", "pgxlisten test", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", receive(t, sub).Payload)
+
+	stopRun()
+	require.ErrorIs(t, <-runErrChan, context.Canceled)
+
+	_, ok := <-sub.Notifications()
+	require.False(t, ok)
+}
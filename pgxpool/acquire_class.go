@@ -0,0 +1,246 @@
+package pgxpool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AcquireClass is a class of Acquire calls with a priority and a reserved share of the pool. See Config.AcquireClasses.
+type AcquireClass struct {
+	// Name identifies the class. It is passed to WithAcquireClass. The class named "" is used for Acquire calls without
+	// a class.
+	Name string
+
+	// Priority orders waiting Acquire calls. When a connection becomes available it is given to the waiting Acquire of
+	// the class with the highest priority. Acquire calls with the same priority are served in order.
+	Priority int
+
+	// ReservedConns is the number of connections that only Acquire calls of this class can use. Other classes can use at
+	// most MaxConns minus the unused reserved connections of all other classes.
+	ReservedConns int32
+}
+
+// AcquireClassStat is a snapshot of the statistics of an AcquireClass.
+type AcquireClassStat struct {
+	Name string
+
+	// AcquiredConns is the number of connections currently acquired by the class.
+	AcquiredConns int32
+
+	// WaitingAcquires is the number of Acquire calls of the class currently waiting for a connection.
+	WaitingAcquires int32
+
+	// AcquireCount is the cumulative count of Acquire calls of the class that were given a connection.
+	AcquireCount int64
+
+	// AcquireWaitDuration is the total time Acquire calls of the class waited for a connection to be given to them.
+	AcquireWaitDuration time.Duration
+
+	// CanceledAcquireCount is the cumulative count of Acquire calls of the class that were canceled by a context while
+	// waiting.
+	CanceledAcquireCount int64
+}
+
+type acquireClassCtxKey struct{}
+
+// WithAcquireClass returns a copy of ctx that makes Acquire use the AcquireClass named name. Acquire uses the class
+// named "" if name is not one of Config.AcquireClasses.
+func WithAcquireClass(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, acquireClassCtxKey{}, name)
+}
+
+type acquireClassState struct {
+	AcquireClass
+	stat AcquireClassStat
+}
+
+type acquireWaiter struct {
+	class   *acquireClassState
+	ready   chan struct{}
+	granted bool
+}
+
+// acquireScheduler limits the number of acquired connections to maxConns and gives connections to waiting Acquire calls
+// by the priority and reserved connections of their class. Acquire only calls the underlying pool after it has been
+// given a connection by the scheduler. The underlying pool can still make it wait for a connection to be released
+// because the health check and Pool.AcquireAllIdle take idle connections without the scheduler. That wait is not
+// ordered by priority but it is limited by MaxWaitingAcquires and MaxAcquireWait like any other.
+type acquireScheduler struct {
+	mux      sync.Mutex
+	maxConns int32
+	acquired int32
+	classes  map[string]*acquireClassState
+	waiters  []*acquireWaiter // Ordered by priority then arrival.
+}
+
+func newAcquireScheduler(maxConns int32, classes []AcquireClass) (*acquireScheduler, error) {
+	s := &acquireScheduler{
+		maxConns: maxConns,
+		classes:  make(map[string]*acquireClassState, len(classes)+1),
+	}
+
+	var reserved int32
+	for _, class := range classes {
+		if _, ok := s.classes[class.Name]; ok {
+			return nil, fmt.Errorf("duplicate AcquireClass %q", class.Name)
+		}
+		if class.ReservedConns < 0 {
+			return nil, fmt.Errorf("AcquireClass %q ReservedConns must not be negative", class.Name)
+		}
+		reserved += class.ReservedConns
+		s.classes[class.Name] = &acquireClassState{AcquireClass: class, stat: AcquireClassStat{Name: class.Name}}
+	}
+	if reserved > maxConns {
+		return nil, fmt.Errorf("AcquireClasses reserve %d connections but MaxConns is %d", reserved, maxConns)
+	}
+
+	if _, ok := s.classes[""]; !ok {
+		s.classes[""] = &acquireClassState{}
+	}
+
+	return s, nil
+}
+
+// acquire waits until a connection is given to the class of ctx. The connection must be returned with release.
+// startWait is called before waiting. If it returns an error acquire fails with that error. Otherwise the function it
+// returns is called when the wait is over.
+func (s *acquireScheduler) acquire(ctx context.Context, startWait func() (endWait func(), err error)) (*acquireClassState, error) {
+	name, _ := ctx.Value(acquireClassCtxKey{}).(string)
+	class, ok := s.classes[name]
+	if !ok {
+		class = s.classes[""]
+	}
+
+	w := &acquireWaiter{class: class, ready: make(chan struct{})}
+
+	s.mux.Lock()
+	s.enqueue(w)
+	s.dispatch()
+	if w.granted {
+		class.stat.AcquireCount++
+		s.mux.Unlock()
+		return class, nil
+	}
+	s.mux.Unlock()
+
+	endWait, err := startWait()
+	if err != nil {
+		s.mux.Lock()
+		if w.granted {
+			// A connection was released after dispatch.
+			class.stat.AcquireCount++
+			s.mux.Unlock()
+			return class, nil
+		}
+		s.remove(w)
+		s.mux.Unlock()
+		return nil, err
+	}
+	defer endWait()
+
+	s.mux.Lock()
+	class.stat.WaitingAcquires++
+	s.mux.Unlock()
+
+	startTime := time.Now()
+	select {
+	case <-w.ready:
+		s.mux.Lock()
+		class.stat.WaitingAcquires--
+		class.stat.AcquireCount++
+		class.stat.AcquireWaitDuration += time.Since(startTime)
+		s.mux.Unlock()
+		return class, nil
+	case <-ctx.Done():
+		s.mux.Lock()
+		class.stat.WaitingAcquires--
+		class.stat.CanceledAcquireCount++
+		if w.granted {
+			s.releaseLocked(class)
+		} else {
+			s.remove(w)
+		}
+		s.mux.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// release returns a connection given to class.
+func (s *acquireScheduler) release(class *acquireClassState) {
+	s.mux.Lock()
+	s.releaseLocked(class)
+	s.mux.Unlock()
+}
+
+func (s *acquireScheduler) releaseLocked(class *acquireClassState) {
+	s.acquired--
+	class.stat.AcquiredConns--
+	s.dispatch()
+}
+
+// enqueue adds w after all waiters with the same or higher priority. s.mux must be held.
+func (s *acquireScheduler) enqueue(w *acquireWaiter) {
+	i := len(s.waiters)
+	for i > 0 && s.waiters[i-1].class.Priority < w.class.Priority {
+		i--
+	}
+	s.waiters = append(s.waiters, nil)
+	copy(s.waiters[i+1:], s.waiters[i:])
+	s.waiters[i] = w
+}
+
+func (s *acquireScheduler) remove(w *acquireWaiter) {
+	for i := range s.waiters {
+		if s.waiters[i] == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch gives connections to waiters in order. A waiter that cannot be given a connection because the remaining
+// connections are reserved for other classes is skipped. s.mux must be held.
+func (s *acquireScheduler) dispatch() {
+	for i := 0; i < len(s.waiters) && s.acquired < s.maxConns; {
+		w := s.waiters[i]
+		if !s.canAcquire(w.class) {
+			i++
+			continue
+		}
+
+		s.acquired++
+		w.class.stat.AcquiredConns++
+		w.granted = true
+		close(w.ready)
+		s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+	}
+}
+
+// canAcquire checks if a connection that is not reserved for another class is available to class. s.mux must be held.
+func (s *acquireScheduler) canAcquire(class *acquireClassState) bool {
+	var reservedByOthers int32
+	for _, c := range s.classes {
+		if c != class && c.stat.AcquiredConns < c.ReservedConns {
+			reservedByOthers += c.ReservedConns - c.stat.AcquiredConns
+		}
+	}
+
+	return s.maxConns-s.acquired > reservedByOthers
+}
+
+// stats returns a snapshot of the statistics of each class ordered by name.
+func (s *acquireScheduler) stats() []AcquireClassStat {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	stats := make([]AcquireClassStat, 0, len(s.classes))
+	for _, class := range s.classes {
+		stats = append(stats, class.stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	return stats
+}
@@ -0,0 +1,119 @@
+package pgxpool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noWaitLimit() (func(), error) {
+	return func() {}, nil
+}
+
+func waitForWaitingAcquires(t *testing.T, s *acquireScheduler, n int32) {
+	require.Eventually(t, func() bool {
+		var waiting int32
+		for _, stat := range s.stats() {
+			waiting += stat.WaitingAcquires
+		}
+		return waiting == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestAcquireSchedulerPriority(t *testing.T) {
+	t.Parallel()
+
+	s, err := newAcquireScheduler(1, []AcquireClass{{Name: "batch", Priority: -1}, {Name: "api", Priority: 10}})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	held, err := s.acquire(ctx, noWaitLimit)
+	require.NoError(t, err)
+
+	acquiredChan := make(chan string, 3)
+	for i, name := range []string{"batch", "", "api"} {
+		go func(name string) {
+			class, err := s.acquire(WithAcquireClass(ctx, name), noWaitLimit)
+			if err != nil {
+				acquiredChan <- err.Error()
+				return
+			}
+			acquiredChan <- name
+			s.release(class)
+		}(name)
+		waitForWaitingAcquires(t, s, int32(i+1))
+	}
+
+	s.release(held)
+	assert.Equal(t, "api", <-acquiredChan)
+	assert.Equal(t, "", <-acquiredChan)
+	assert.Equal(t, "batch", <-acquiredChan)
+
+	stats := s.stats()
+	require.Len(t, stats, 3)
+	assert.Equal(t, "", stats[0].Name)
+	assert.EqualValues(t, 2, stats[0].AcquireCount)
+	assert.Equal(t, "api", stats[1].Name)
+	assert.EqualValues(t, 1, stats[1].AcquireCount)
+	assert.Greater(t, stats[1].AcquireWaitDuration, time.Duration(0))
+	assert.Equal(t, "batch", stats[2].Name)
+	assert.Greater(t, stats[2].AcquireWaitDuration, stats[1].AcquireWaitDuration)
+	for _, stat := range stats {
+		assert.EqualValues(t, 0, stat.AcquiredConns)
+		assert.EqualValues(t, 0, stat.WaitingAcquires)
+	}
+}
+
+func TestAcquireSchedulerReservedConns(t *testing.T) {
+	t.Parallel()
+
+	s, err := newAcquireScheduler(2, []AcquireClass{{Name: "api", ReservedConns: 1}})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	batch, err := s.acquire(WithAcquireClass(ctx, "unknown"), noWaitLimit)
+	require.NoError(t, err)
+
+	// The remaining connection is reserved for api.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = s.acquire(timeoutCtx, noWaitLimit)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	api, err := s.acquire(WithAcquireClass(ctx, "api"), noWaitLimit)
+	require.NoError(t, err)
+
+	// api can use unreserved connections too.
+	apiWaitChan := make(chan error)
+	go func() {
+		_, err := s.acquire(WithAcquireClass(ctx, "api"), noWaitLimit)
+		apiWaitChan <- err
+	}()
+	waitForWaitingAcquires(t, s, 1)
+	s.release(batch)
+	require.NoError(t, <-apiWaitChan)
+
+	stats := s.stats()
+	require.Len(t, stats, 2)
+	assert.EqualValues(t, 0, stats[0].AcquiredConns)
+	assert.EqualValues(t, 1, stats[0].CanceledAcquireCount)
+	assert.EqualValues(t, 2, stats[1].AcquiredConns)
+
+	s.release(api)
+}
+
+func TestNewAcquireSchedulerValidatesClasses(t *testing.T) {
+	t.Parallel()
+
+	_, err := newAcquireScheduler(4, []AcquireClass{{Name: "a"}, {Name: "a"}})
+	require.EqualError(t, err, `duplicate AcquireClass "a"`)
+
+	_, err = newAcquireScheduler(4, []AcquireClass{{Name: "a", ReservedConns: -1}})
+	require.EqualError(t, err, `AcquireClass "a" ReservedConns must not be negative`)
+
+	_, err = newAcquireScheduler(4, []AcquireClass{{Name: "a", ReservedConns: 3}, {Name: "b", ReservedConns: 2}})
+	require.EqualError(t, err, "AcquireClasses reserve 5 connections but MaxConns is 4")
+}
@@ -148,6 +148,13 @@ func assertConfigsEqual(t *testing.T, expected, actual *pgxpool.Config, testName
 	assert.Equalf(t, expected.MaxConns, actual.MaxConns, "%s - MaxConns", testName)
 	assert.Equalf(t, expected.MinConns, actual.MinConns, "%s - MinConns", testName)
 	assert.Equalf(t, expected.HealthCheckPeriod, actual.HealthCheckPeriod, "%s - HealthCheckPeriod", testName)
+	assert.Equalf(t, expected.AcquireClasses, actual.AcquireClasses, "%s - AcquireClasses", testName)
+	assert.Equalf(t, expected.MaxWaitingAcquires, actual.MaxWaitingAcquires, "%s - MaxWaitingAcquires", testName)
+	assert.Equalf(t, expected.MaxAcquireWait, actual.MaxAcquireWait, "%s - MaxAcquireWait", testName)
+	assert.Equalf(t, expected.PreparedStatements, actual.PreparedStatements, "%s - PreparedStatements", testName)
+	assert.Equalf(t, expected.WarmupConns, actual.WarmupConns, "%s - WarmupConns", testName)
+	assert.Equalf(t, expected.WarmupTimeout, actual.WarmupTimeout, "%s - WarmupTimeout", testName)
+	assert.Equalf(t, expected.MaxReplicationLag, actual.MaxReplicationLag, "%s - MaxReplicationLag", testName)
 
 	assertConnConfigsEqual(t, expected.ConnConfig, actual.ConnConfig, testName)
 }
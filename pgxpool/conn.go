@@ -11,8 +11,9 @@ import (
 
 // Conn is an acquired *pgx.Conn from a Pool.
 type Conn struct {
-	res *puddle.Resource[*connResource]
-	p   *Pool
+	res   *puddle.Resource[*connResource]
+	p     *Pool
+	class *acquireClassState
 }
 
 // Release returns c to the pool it was acquired from. Once Release has been called, other methods must not be called.
@@ -25,6 +26,8 @@ func (c *Conn) Release() {
 	conn := c.Conn()
 	res := c.res
 	c.res = nil
+	class := c.class
+	c.class = nil
 
 	if c.p.releaseTracer != nil {
 		c.p.releaseTracer.TraceRelease(c.p, TraceReleaseData{Conn: conn})
@@ -32,6 +35,7 @@ func (c *Conn) Release() {
 
 	if conn.IsClosed() || conn.PgConn().IsBusy() || conn.PgConn().TxStatus() != 'I' {
 		res.Destroy()
+		c.p.releaseAcquireClass(class)
 		// Signal to the health check to run since we just destroyed a connections
 		// and we might be below minConns now
 		c.p.triggerHealthCheck()
@@ -44,6 +48,7 @@ func (c *Conn) Release() {
 	if c.p.isExpired(res) {
 		atomic.AddInt64(&c.p.lifetimeDestroyCount, 1)
 		res.Destroy()
+		c.p.releaseAcquireClass(class)
 		// Signal to the health check to run since we just destroyed a connections
 		// and we might be below minConns now
 		c.p.triggerHealthCheck()
@@ -52,10 +57,12 @@ func (c *Conn) Release() {
 
 	if c.p.afterRelease == nil {
 		res.Release()
+		c.p.releaseAcquireClass(class)
 		return
 	}
 
 	go func() {
+		defer c.p.releaseAcquireClass(class)
 		if c.p.afterRelease(conn) {
 			res.Release()
 		} else {
@@ -79,6 +86,8 @@ func (c *Conn) Hijack() *pgx.Conn {
 	c.res = nil
 
 	res.Hijack()
+	c.p.releaseAcquireClass(c.class)
+	c.class = nil
 
 	return conn
 }
@@ -2,6 +2,7 @@ package pgxpool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"runtime"
@@ -27,6 +28,7 @@ type connResource struct {
 	poolRows   []poolRow
 	poolRowss  []poolRows
 	maxAgeTime time.Time
+	host       string
 }
 
 func (cr *connResource) getConn(p *Pool, res *puddle.Resource[*connResource]) *Conn {
@@ -71,6 +73,9 @@ func (cr *connResource) getPoolRows(c *Conn, r pgx.Rows) *poolRows {
 	return pr
 }
 
+// ErrPoolExhausted is returned by Acquire when Config.MaxWaitingAcquires or Config.MaxAcquireWait is exceeded.
+var ErrPoolExhausted = errors.New("pool exhausted")
+
 // Pool allows for connection reuse.
 type Pool struct {
 	// 64 bit fields accessed with atomics must be at beginning of struct to guarantee alignment for certain 32-bit
@@ -78,6 +83,7 @@ type Pool struct {
 	newConnsCount        int64
 	lifetimeDestroyCount int64
 	idleDestroyCount     int64
+	rejectedAcquireCount int64
 
 	p                     *puddle.Pool[*connResource]
 	config                *Config
@@ -92,12 +98,21 @@ type Pool struct {
 	maxConnLifetimeJitter time.Duration
 	maxConnIdleTime       time.Duration
 	healthCheckPeriod     time.Duration
+	maxWaitingAcquires    int32
+	maxAcquireWait        time.Duration
+	preparedStatements    []string
+
+	acquiring       int32 // Accessed with atomics.
+	waitingAcquires int32 // Accessed with atomics.
 
 	healthCheckChan chan struct{}
 
 	acquireTracer AcquireTracer
 	releaseTracer ReleaseTracer
 
+	acquireScheduler *acquireScheduler
+	replicationLag   *replicationLagMonitor
+
 	closeOnce sync.Once
 	closeChan chan struct{}
 }
@@ -147,6 +162,46 @@ type Config struct {
 	// HealthCheckPeriod is the duration between checks of the health of idle connections.
 	HealthCheckPeriod time.Duration
 
+	// MaxWaitingAcquires is the maximum number of Acquire calls that may wait for a connection to be released when
+	// MaxConns connections are in use or being established. Acquire fails with ErrPoolExhausted instead of waiting when
+	// it is reached. Acquire calls that wait for a new connection to be established are not limited. If it is 0 the
+	// number of waiting Acquire calls is not limited.
+	MaxWaitingAcquires int32
+
+	// MaxAcquireWait is the maximum duration Acquire waits for a connection to be released when MaxConns connections are
+	// in use or being established. Acquire fails with ErrPoolExhausted when it is exceeded. Establishing a new
+	// connection is only limited by the context passed to Acquire and ConnConfig.ConnectTimeout. If it is 0 Acquire
+	// waits until its context is done.
+	MaxAcquireWait time.Duration
+
+	// PreparedStatements are prepared on each new connection after AfterConnect. They are prepared with a single
+	// pipeline as if by pgx.Conn.Prepare with the SQL as the name so queries with the same SQL use them. A connection
+	// that fails to prepare them is closed.
+	PreparedStatements []string
+
+	// WarmupConns is the number of connections NewWithConfig establishes before it returns. NewWithConfig fails if they
+	// cannot be established. If it is 0 NewWithConfig returns without waiting for any connections.
+	WarmupConns int32
+
+	// WarmupTimeout is the maximum duration NewWithConfig waits for WarmupConns connections to be established. If it is
+	// 0 NewWithConfig waits until its context is done.
+	WarmupTimeout time.Duration
+
+	// MaxReplicationLag enables measuring the replication lag of the hosts the pool connects to. It is measured when a
+	// connection is established and by the health check on an idle connection to each host. A connection is not
+	// established to a host whose lag exceeds MaxReplicationLag. Connections to such a host are closed instead of being
+	// acquired until a measurement is at or below MaxReplicationLag. The health check measures such a host with a
+	// dedicated connection. This is useful when the connection string lists
+	// multiple standby hosts. The last measurement of each host is reported by Stat.HostReplicationLags. If it is 0 the
+	// replication lag is not measured.
+	MaxReplicationLag time.Duration
+
+	// AcquireClasses enables prioritized acquisition. The class of an Acquire call is set with WithAcquireClass. When
+	// the pool is exhausted connections are given to waiting Acquire calls by the Priority of their class instead of in
+	// order of arrival. A class can also reserve connections for its own use. If AcquireClasses is empty connections
+	// are given in order of arrival.
+	AcquireClasses []AcquireClass
+
 	createdByParseConfig bool // Used to enforce created by ParseConfig rule.
 }
 
@@ -157,6 +212,8 @@ func (c *Config) Copy() *Config {
 	newConfig := new(Config)
 	*newConfig = *c
 	newConfig.ConnConfig = c.ConnConfig.Copy()
+	newConfig.PreparedStatements = append([]string(nil), c.PreparedStatements...)
+	newConfig.AcquireClasses = append([]AcquireClass(nil), c.AcquireClasses...)
 	return newConfig
 }
 
@@ -194,10 +251,29 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 		maxConnLifetimeJitter: config.MaxConnLifetimeJitter,
 		maxConnIdleTime:       config.MaxConnIdleTime,
 		healthCheckPeriod:     config.HealthCheckPeriod,
+		maxWaitingAcquires:    config.MaxWaitingAcquires,
+		maxAcquireWait:        config.MaxAcquireWait,
+		preparedStatements:    config.PreparedStatements,
 		healthCheckChan:       make(chan struct{}, 1),
 		closeChan:             make(chan struct{}),
 	}
 
+	if config.WarmupConns > config.MaxConns {
+		return nil, fmt.Errorf("WarmupConns %d is greater than MaxConns %d", config.WarmupConns, config.MaxConns)
+	}
+
+	if len(config.AcquireClasses) > 0 {
+		var err error
+		p.acquireScheduler, err = newAcquireScheduler(config.MaxConns, config.AcquireClasses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.MaxReplicationLag > 0 {
+		p.replicationLag = newReplicationLagMonitor(config.MaxReplicationLag)
+	}
+
 	if t, ok := config.ConnConfig.Tracer.(AcquireTracer); ok {
 		p.acquireTracer = t
 	}
@@ -224,6 +300,19 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 					}
 				}
 
+				// Validating the lag while connecting lets a connection fall back to the next host.
+				if p.replicationLag != nil {
+					validateConnect := connConfig.ValidateConnect
+					connConfig.ValidateConnect = func(ctx context.Context, pgConn *pgconn.PgConn) error {
+						if validateConnect != nil {
+							if err := validateConnect(ctx, pgConn); err != nil {
+								return err
+							}
+						}
+						return p.replicationLag.measure(ctx, pgConn)
+					}
+				}
+
 				conn, err := pgx.ConnectConfig(ctx, connConfig)
 				if err != nil {
 					return nil, err
@@ -237,6 +326,14 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 					}
 				}
 
+				if len(p.preparedStatements) > 0 {
+					err = conn.PrepareAll(ctx, p.preparedStatements...)
+					if err != nil {
+						conn.Close(ctx)
+						return nil, err
+					}
+				}
+
 				jitterSecs := rand.Float64() * config.MaxConnLifetimeJitter.Seconds()
 				maxAgeTime := time.Now().Add(config.MaxConnLifetime).Add(time.Duration(jitterSecs) * time.Second)
 
@@ -246,6 +343,7 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 					poolRows:   make([]poolRow, 64),
 					poolRowss:  make([]poolRows, 64),
 					maxAgeTime: maxAgeTime,
+					host:       connHost(conn.PgConn()),
 				}
 
 				return cr, nil
@@ -270,8 +368,18 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 		return nil, err
 	}
 
+	if config.WarmupConns > 0 {
+		if err := p.warmup(ctx, config.WarmupConns, config.WarmupTimeout); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
 	go func() {
-		p.createIdleResources(ctx, int(p.minConns))
+		// Connections established by warmup count toward MinConns.
+		if toCreate := p.minConns - p.Stat().TotalConns(); toCreate > 0 {
+			p.createIdleResources(ctx, int(toCreate))
+		}
 		p.backgroundHealthCheck()
 	}()
 
@@ -287,6 +395,11 @@ func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
 //   - pool_max_conn_idle_time: duration string (default 30 minutes)
 //   - pool_health_check_period: duration string (default 1 minute)
 //   - pool_max_conn_lifetime_jitter: duration string (default 0)
+//   - pool_max_waiting_acquires: integer 0 or greater (default 0)
+//   - pool_max_acquire_wait: duration string (default 0)
+//   - pool_warmup_conns: integer 0 or greater (default 0)
+//   - pool_warmup_timeout: duration string (default 0)
+//   - pool_max_replication_lag: duration string (default 0)
 //
 // See Config for definitions of these arguments.
 //
@@ -376,6 +489,57 @@ func ParseConfig(connString string) (*Config, error) {
 		config.MaxConnLifetimeJitter = d
 	}
 
+	if s, ok := config.ConnConfig.Config.RuntimeParams["pool_max_waiting_acquires"]; ok {
+		delete(connConfig.Config.RuntimeParams, "pool_max_waiting_acquires")
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse pool_max_waiting_acquires: %w", err)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("pool_max_waiting_acquires too small: %d", n)
+		}
+		config.MaxWaitingAcquires = int32(n)
+	}
+
+	if s, ok := config.ConnConfig.Config.RuntimeParams["pool_max_acquire_wait"]; ok {
+		delete(connConfig.Config.RuntimeParams, "pool_max_acquire_wait")
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pool_max_acquire_wait: %w", err)
+		}
+		config.MaxAcquireWait = d
+	}
+
+	if s, ok := config.ConnConfig.Config.RuntimeParams["pool_warmup_conns"]; ok {
+		delete(connConfig.Config.RuntimeParams, "pool_warmup_conns")
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse pool_warmup_conns: %w", err)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("pool_warmup_conns too small: %d", n)
+		}
+		config.WarmupConns = int32(n)
+	}
+
+	if s, ok := config.ConnConfig.Config.RuntimeParams["pool_warmup_timeout"]; ok {
+		delete(connConfig.Config.RuntimeParams, "pool_warmup_timeout")
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pool_warmup_timeout: %w", err)
+		}
+		config.WarmupTimeout = d
+	}
+
+	if s, ok := config.ConnConfig.Config.RuntimeParams["pool_max_replication_lag"]; ok {
+		delete(connConfig.Config.RuntimeParams, "pool_max_replication_lag")
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pool_max_replication_lag: %w", err)
+		}
+		config.MaxReplicationLag = d
+	}
+
 	return config, nil
 }
 
@@ -420,6 +584,10 @@ func (p *Pool) backgroundHealthCheck() {
 }
 
 func (p *Pool) checkHealth() {
+	if p.replicationLag != nil {
+		p.checkReplicationLag()
+	}
+
 	for {
 		// If checkMinConns failed we don't destroy any connections since we couldn't
 		// even get to minConns
@@ -479,6 +647,22 @@ func (p *Pool) checkMinConns() error {
 	return nil
 }
 
+// warmup establishes conns connections. It fails if they are not established within timeout.
+func (p *Pool) warmup(ctx context.Context, conns int32, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := p.createIdleResources(ctx, int(conns))
+	if err != nil {
+		return fmt.Errorf("cannot warm up pool to %d connections: %w", conns, err)
+	}
+
+	return nil
+}
+
 func (p *Pool) createIdleResources(parentCtx context.Context, targetResources int) error {
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
@@ -521,14 +705,30 @@ func (p *Pool) Acquire(ctx context.Context) (c *Conn, err error) {
 		}()
 	}
 
+	var class *acquireClassState
+	if p.acquireScheduler != nil {
+		waitCtx, cancel := p.acquireWaitContext(ctx)
+		class, err = p.acquireScheduler.acquire(waitCtx, p.startWait)
+		cancel()
+		if err != nil {
+			return nil, p.acquireWaitError(ctx, err)
+		}
+	}
+
 	for {
-		res, err := p.p.Acquire(ctx)
+		res, err := p.acquireResource(ctx)
 		if err != nil {
+			p.releaseAcquireClass(class)
 			return nil, err
 		}
 
 		cr := res.Value()
 
+		if p.replicationLag != nil && p.replicationLag.excluded(cr.host) {
+			res.Destroy()
+			continue
+		}
+
 		if res.IdleDuration() > time.Second {
 			err := cr.conn.Ping(ctx)
 			if err != nil {
@@ -538,13 +738,97 @@ func (p *Pool) Acquire(ctx context.Context) (c *Conn, err error) {
 		}
 
 		if p.beforeAcquire == nil || p.beforeAcquire(ctx, cr.conn) {
-			return cr.getConn(p, res), nil
+			c := cr.getConn(p, res)
+			c.class = class
+			return c, nil
 		}
 
 		res.Destroy()
 	}
 }
 
+// acquireResource acquires a resource from the underlying pool. If the pool is exhausted the Acquire has to wait for a
+// connection to be released and MaxWaitingAcquires and MaxAcquireWait apply. This is also the case for an Acquire that
+// the acquire scheduler has given a connection because other users of the underlying pool may hold it.
+func (p *Pool) acquireResource(ctx context.Context) (*puddle.Resource[*connResource], error) {
+	if p.maxWaitingAcquires == 0 && p.maxAcquireWait == 0 {
+		return p.p.Acquire(ctx)
+	}
+
+	// Acquire calls in progress are counted so that a burst of them cannot all see an idle connection or room to grow
+	// and then wait in the underlying pool without limit.
+	acquiring := atomic.AddInt32(&p.acquiring, 1)
+	defer atomic.AddInt32(&p.acquiring, -1)
+
+	if !p.exhausted(acquiring) {
+		return p.p.Acquire(ctx)
+	}
+
+	endWait, err := p.startWait()
+	if err != nil {
+		return nil, err
+	}
+	defer endWait()
+
+	waitCtx, cancel := p.acquireWaitContext(ctx)
+	defer cancel()
+
+	res, err := p.p.Acquire(waitCtx)
+	if err != nil {
+		return nil, p.acquireWaitError(ctx, err)
+	}
+	return res, nil
+}
+
+// exhausted checks if an Acquire would have to wait for a connection to be released. That is the case if no connection
+// is idle and no new connection can be established or if more Acquire calls are in progress than there are connections
+// that are not acquired. acquiring is the number of Acquire calls in progress including the caller.
+func (p *Pool) exhausted(acquiring int32) bool {
+	stat := p.p.Stat()
+	if acquiring > stat.MaxResources()-stat.AcquiredResources() {
+		return true
+	}
+	return stat.IdleResources() == 0 && stat.TotalResources() >= stat.MaxResources()
+}
+
+// acquireWaitContext returns a copy of ctx that is canceled when MaxAcquireWait is exceeded.
+func (p *Pool) acquireWaitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.maxAcquireWait > 0 {
+		return context.WithTimeout(ctx, p.maxAcquireWait)
+	}
+	return ctx, func() {}
+}
+
+// startWait registers an Acquire that has to wait for a connection. It returns ErrPoolExhausted if MaxWaitingAcquires
+// Acquire calls are already waiting. Otherwise endWait must be called when the Acquire stops waiting.
+func (p *Pool) startWait() (endWait func(), err error) {
+	if atomic.AddInt32(&p.waitingAcquires, 1) > p.maxWaitingAcquires && p.maxWaitingAcquires > 0 {
+		atomic.AddInt32(&p.waitingAcquires, -1)
+		atomic.AddInt64(&p.rejectedAcquireCount, 1)
+		return nil, ErrPoolExhausted
+	}
+
+	return func() { atomic.AddInt32(&p.waitingAcquires, -1) }, nil
+}
+
+// acquireWaitError converts err to ErrPoolExhausted if waiting for a connection to be released failed because
+// MaxAcquireWait was exceeded. ctx is the context passed to Acquire.
+func (p *Pool) acquireWaitError(ctx context.Context, err error) error {
+	if p.maxAcquireWait > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		atomic.AddInt64(&p.rejectedAcquireCount, 1)
+		return ErrPoolExhausted
+	}
+	return err
+}
+
+// releaseAcquireClass returns a connection given to class by the acquire scheduler. class is nil when the pool has no
+// AcquireClasses.
+func (p *Pool) releaseAcquireClass(class *acquireClassState) {
+	if class != nil {
+		p.acquireScheduler.release(class)
+	}
+}
+
 // AcquireFunc acquires a *Conn and calls f with that *Conn. ctx will only affect the Acquire. It has no effect on the
 // call of f. The return value is either an error acquiring the *Conn or the return value of f. The *Conn is
 // automatically released after the call of f.
@@ -589,11 +873,25 @@ func (p *Pool) Config() *Config { return p.config.Copy() }
 
 // Stat returns a pgxpool.Stat struct with a snapshot of Pool statistics.
 func (p *Pool) Stat() *Stat {
+	var acquireClassStats []AcquireClassStat
+	if p.acquireScheduler != nil {
+		acquireClassStats = p.acquireScheduler.stats()
+	}
+
+	var hostReplicationLags []HostReplicationLag
+	if p.replicationLag != nil {
+		hostReplicationLags = p.replicationLag.stats()
+	}
+
 	return &Stat{
 		s:                    p.p.Stat(),
 		newConnsCount:        atomic.LoadInt64(&p.newConnsCount),
 		lifetimeDestroyCount: atomic.LoadInt64(&p.lifetimeDestroyCount),
 		idleDestroyCount:     atomic.LoadInt64(&p.idleDestroyCount),
+		rejectedAcquireCount: atomic.LoadInt64(&p.rejectedAcquireCount),
+		waitingAcquires:      atomic.LoadInt32(&p.waitingAcquires),
+		acquireClassStats:    acquireClassStats,
+		hostReplicationLags:  hostReplicationLags,
 	}
 }
 
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/internal/pgmock"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/pgxtest"
 	"github.com/stretchr/testify/assert"
@@ -51,6 +53,357 @@ func TestParseConfigExtractsPoolArguments(t *testing.T) {
 	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_min_conns")
 }
 
+func TestParseConfigExtractsAcquireLimits(t *testing.T) {
+	t.Parallel()
+
+	config, err := pgxpool.ParseConfig("pool_max_waiting_acquires=100 pool_max_acquire_wait=250ms")
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, config.MaxWaitingAcquires)
+	assert.Equal(t, 250*time.Millisecond, config.MaxAcquireWait)
+	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_max_waiting_acquires")
+	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_max_acquire_wait")
+
+	_, err = pgxpool.ParseConfig("pool_max_waiting_acquires=-1")
+	require.Error(t, err)
+	_, err = pgxpool.ParseConfig("pool_max_acquire_wait=forever")
+	require.Error(t, err)
+}
+
+// newBlockedConnectConfig returns a config for a pool with one connection whose connection attempts block until unblock
+// is called. unblock must be called before the pool is closed.
+func newBlockedConnectConfig(t *testing.T) (config *pgxpool.Config, unblock func()) {
+	config, err := pgxpool.ParseConfig("host=127.0.0.1 port=1 pool_max_conns=1")
+	require.NoError(t, err)
+
+	blockConnect := make(chan struct{})
+	config.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		select {
+		case <-blockConnect:
+			return errors.New("connect blocked")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return config, func() { close(blockConnect) }
+}
+
+func TestPoolAcquireMaxWaitingAcquires(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, unblock := newBlockedConnectConfig(t)
+	config.MaxWaitingAcquires = 1
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+	defer unblock()
+
+	waitCtx, waitCancel := context.WithCancel(ctx)
+	waitErrChan := make(chan error, 2)
+	acquire := func() {
+		_, err := pool.Acquire(waitCtx)
+		waitErrChan <- err
+	}
+
+	// Waiting for a new connection to be established does not count as waiting and only establishes one connection.
+	go acquire()
+	require.Eventually(t, func() bool { return pool.Stat().TotalConns() == 1 }, 5*time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, pool.Stat().NewConnsCount())
+
+	// Only one Acquire can wait for the connection to be released.
+	go acquire()
+	require.Eventually(t, func() bool {
+		shortCtx, shortCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer shortCancel()
+		_, err := pool.Acquire(shortCtx)
+		return errors.Is(err, pgxpool.ErrPoolExhausted)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, pool.Stat().RejectedAcquireCount(), int64(1))
+	assert.EqualValues(t, 1, pool.Stat().NewConnsCount())
+
+	waitCancel()
+	require.ErrorIs(t, <-waitErrChan, context.Canceled)
+	require.ErrorIs(t, <-waitErrChan, context.Canceled)
+}
+
+func TestPoolAcquireMaxWaitingAcquiresBurst(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, unblock := newBlockedConnectConfig(t)
+	config.MaxWaitingAcquires = 2
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+	defer unblock()
+
+	const acquireCount = 50
+	waitCtx, waitCancel := context.WithCancel(ctx)
+	defer waitCancel()
+
+	var maxWaitingAcquires int32
+	monitorDone := make(chan struct{})
+	stopMonitor := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		for {
+			if n := pool.Stat().WaitingAcquires(); n > atomic.LoadInt32(&maxWaitingAcquires) {
+				atomic.StoreInt32(&maxWaitingAcquires, n)
+			}
+			select {
+			case <-stopMonitor:
+				return
+			default:
+			}
+		}
+	}()
+
+	errChan := make(chan error, acquireCount)
+	for i := 0; i < acquireCount; i++ {
+		go func() {
+			_, err := pool.Acquire(waitCtx)
+			errChan <- err
+		}()
+	}
+
+	// One Acquire establishes the only connection and MaxWaitingAcquires wait for it. All others are rejected.
+	rejected := acquireCount - int(config.MaxConns) - int(config.MaxWaitingAcquires)
+	for i := 0; i < rejected; i++ {
+		require.ErrorIs(t, <-errChan, pgxpool.ErrPoolExhausted)
+	}
+	assert.EqualValues(t, rejected, pool.Stat().RejectedAcquireCount())
+	require.Eventually(t, func() bool {
+		return pool.Stat().WaitingAcquires() == config.MaxWaitingAcquires
+	}, 5*time.Second, time.Millisecond)
+
+	waitCancel()
+	for i := rejected; i < acquireCount; i++ {
+		require.ErrorIs(t, <-errChan, context.Canceled)
+	}
+
+	close(stopMonitor)
+	<-monitorDone
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxWaitingAcquires), config.MaxWaitingAcquires)
+	assert.EqualValues(t, 0, pool.Stat().WaitingAcquires())
+}
+
+func TestPoolAcquireMaxAcquireWait(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, unblock := newBlockedConnectConfig(t)
+	config.MaxAcquireWait = 50 * time.Millisecond
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+	defer unblock()
+
+	// A connection that is slow to establish is not reported as the pool being exhausted.
+	connectCtx, connectCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer connectCancel()
+	_, err = pool.Acquire(connectCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 0, pool.Stat().RejectedAcquireCount())
+
+	// The connection is still being established so Acquire has to wait for a release.
+	_, err = pool.Acquire(ctx)
+	require.ErrorIs(t, err, pgxpool.ErrPoolExhausted)
+	assert.EqualValues(t, 1, pool.Stat().RejectedAcquireCount())
+
+	// A context that expires first is reported as such.
+	shortCtx, shortCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer shortCancel()
+	_, err = pool.Acquire(shortCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 1, pool.Stat().RejectedAcquireCount())
+}
+
+func TestParseConfigExtractsWarmupArguments(t *testing.T) {
+	t.Parallel()
+
+	config, err := pgxpool.ParseConfig("pool_warmup_conns=3 pool_warmup_timeout=5s")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, config.WarmupConns)
+	assert.Equal(t, 5*time.Second, config.WarmupTimeout)
+	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_warmup_conns")
+	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_warmup_timeout")
+
+	_, err = pgxpool.ParseConfig("pool_warmup_conns=-1")
+	require.Error(t, err)
+	_, err = pgxpool.ParseConfig("pool_warmup_timeout=soon")
+	require.Error(t, err)
+}
+
+func TestPoolWarmupTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, unblock := newBlockedConnectConfig(t)
+	defer unblock()
+	config.WarmupConns = 1
+	config.WarmupTimeout = 50 * time.Millisecond
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Nil(t, pool)
+
+	config.WarmupConns = config.MaxConns + 1
+	_, err = pgxpool.NewWithConfig(ctx, config)
+	require.Error(t, err)
+}
+
+func TestPoolWarmupAndPreparedStatements(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, err := pgxpool.ParseConfig(os.Getenv("PGX_TEST_DATABASE"))
+	require.NoError(t, err)
+	config.MaxConns = 4
+	config.WarmupConns = 3
+	config.WarmupTimeout = 30 * time.Second
+	config.PreparedStatements = []string{"select $1::int", "select $1::text"}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	stats := pool.Stat()
+	assert.EqualValues(t, 3, stats.TotalConns())
+	assert.EqualValues(t, 3, stats.NewConnsCount())
+
+	c, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	defer c.Release()
+
+	var count int
+	err = c.QueryRow(ctx, "select count(*) from pg_prepared_statements where statement in ('select $1::int', 'select $1::text')", pgx.QueryExecModeSimpleProtocol).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	config.PreparedStatements = []string{"select foo"}
+	_, err = pgxpool.NewWithConfig(ctx, config)
+	require.Error(t, err)
+}
+
+func TestPoolWarmupCountsTowardMinConns(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, err := pgxpool.ParseConfig(os.Getenv("PGX_TEST_DATABASE"))
+	require.NoError(t, err)
+	config.MaxConns = 10
+	config.MinConns = 3
+	config.WarmupConns = 3
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	assert.EqualValues(t, 3, pool.Stat().TotalConns())
+
+	// Give the background creation of MinConns connections a chance to run.
+	time.Sleep(500 * time.Millisecond)
+	assert.EqualValues(t, 3, pool.Stat().TotalConns())
+	assert.EqualValues(t, 3, pool.Stat().NewConnsCount())
+}
+
+func TestParseConfigExtractsMaxReplicationLag(t *testing.T) {
+	t.Parallel()
+
+	config, err := pgxpool.ParseConfig("pool_max_replication_lag=10s")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, config.MaxReplicationLag)
+	assert.NotContains(t, config.ConnConfig.Config.RuntimeParams, "pool_max_replication_lag")
+
+	_, err = pgxpool.ParseConfig("pool_max_replication_lag=far")
+	require.Error(t, err)
+}
+
+// startMockStandby starts a mock standby that reports a replication lag of lag seconds for each query. It returns the
+// address of the standby.
+func startMockStandby(t *testing.T, replayLSN, lag string) string {
+	ln, err := pgmock.StartStandby(replayLSN, lag)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+func TestPoolMaxReplicationLag(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	laggingAddr := startMockStandby(t, "0/3000148", "12.5")
+	currentAddr := startMockStandby(t, "0/3000200", "0.25")
+	laggingHost, laggingPort, _ := strings.Cut(laggingAddr, ":")
+	currentHost, currentPort, _ := strings.Cut(currentAddr, ":")
+
+	config, err := pgxpool.ParseConfig(fmt.Sprintf("host=%s,%s port=%s,%s sslmode=disable pool_max_replication_lag=10s",
+		laggingHost, currentHost, laggingPort, currentPort))
+	require.NoError(t, err)
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// The lagging host is skipped when connecting.
+	c, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, currentAddr, c.Conn().PgConn().Conn().RemoteAddr().String())
+	c.Release()
+
+	stats := pool.Stat().HostReplicationLags()
+	require.Len(t, stats, 2)
+	byHost := map[string]pgxpool.HostReplicationLag{stats[0].Host: stats[0], stats[1].Host: stats[1]}
+
+	assert.True(t, byHost[laggingAddr].Standby)
+	assert.True(t, byHost[laggingAddr].Excluded)
+	assert.Equal(t, 12500*time.Millisecond, byHost[laggingAddr].Lag)
+	assert.Equal(t, "0/3000148", byHost[laggingAddr].ReplayLSN)
+
+	assert.True(t, byHost[currentAddr].Standby)
+	assert.False(t, byHost[currentAddr].Excluded)
+	assert.Equal(t, 250*time.Millisecond, byHost[currentAddr].Lag)
+
+	// No host is within the limit.
+	config, err = pgxpool.ParseConfig(fmt.Sprintf("host=%s port=%s sslmode=disable pool_max_replication_lag=10s", laggingHost, laggingPort))
+	require.NoError(t, err)
+	config.HealthCheckPeriod = 50 * time.Millisecond
+	pool, err = pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	_, err = pool.Acquire(ctx)
+	require.ErrorIs(t, err, pgxpool.ErrReplicationLag)
+
+	// The health check measures the excluded host again although the pool has no connection to it.
+	stats = pool.Stat().HostReplicationLags()
+	require.Len(t, stats, 1)
+	excludedAt := stats[0].MeasuredAt
+	require.Eventually(t, func() bool {
+		stats := pool.Stat().HostReplicationLags()
+		return stats[0].MeasuredAt.After(excludedAt)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, pool.Stat().HostReplicationLags()[0].Excluded)
+	assert.EqualValues(t, 0, pool.Stat().TotalConns())
+}
+
 func TestConstructorIgnoresContext(t *testing.T) {
 	t.Parallel()
 
@@ -122,6 +475,87 @@ func TestPoolAcquireAndConnRelease(t *testing.T) {
 	c.Release()
 }
 
+func TestPoolAcquireClass(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config, err := pgxpool.ParseConfig(os.Getenv("PGX_TEST_DATABASE"))
+	require.NoError(t, err)
+	config.MaxConns = 2
+	config.AcquireClasses = []pgxpool.AcquireClass{{Name: "api", Priority: 10, ReservedConns: 1}}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	c1, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+
+	// The other connection is reserved for api.
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer timeoutCancel()
+	_, err = pool.Acquire(timeoutCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	c2, err := pool.Acquire(pgxpool.WithAcquireClass(ctx, "api"))
+	require.NoError(t, err)
+
+	stats := pool.Stat().AcquireClassStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "", stats[0].Name)
+	assert.EqualValues(t, 1, stats[0].AcquiredConns)
+	assert.EqualValues(t, 1, stats[0].AcquireCount)
+	assert.EqualValues(t, 1, stats[0].CanceledAcquireCount)
+	assert.Equal(t, "api", stats[1].Name)
+	assert.EqualValues(t, 1, stats[1].AcquiredConns)
+
+	c1.Release()
+	c2.Hijack().Close(ctx)
+
+	for _, stat := range pool.Stat().AcquireClassStats() {
+		assert.EqualValues(t, 0, stat.AcquiredConns)
+	}
+}
+
+func TestPoolAcquireClassWaitIsLimited(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	host, port, _ := strings.Cut(startMockStandby(t, "0/3000148", "0"), ":")
+	config, err := pgxpool.ParseConfig(fmt.Sprintf("host=%s port=%s sslmode=disable pool_max_conns=1", host, port))
+	require.NoError(t, err)
+	config.AcquireClasses = []pgxpool.AcquireClass{{Name: "api", Priority: 10}}
+	config.MaxAcquireWait = 50 * time.Millisecond
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	c, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	c.Release()
+
+	// AcquireAllIdle takes the only connection without the acquire scheduler. An Acquire given a connection by the
+	// scheduler still has to wait for it to be released and that wait is limited.
+	idle := pool.AcquireAllIdle(ctx)
+	require.Len(t, idle, 1)
+	_, err = pool.Acquire(pgxpool.WithAcquireClass(ctx, "api"))
+	require.ErrorIs(t, err, pgxpool.ErrPoolExhausted)
+	idle[0].Release()
+
+	c, err = pool.Acquire(pgxpool.WithAcquireClass(ctx, "api"))
+	require.NoError(t, err)
+	c.Release()
+
+	for _, stat := range pool.Stat().AcquireClassStats() {
+		assert.EqualValues(t, 0, stat.AcquiredConns)
+	}
+}
+
 func TestPoolAcquireAndConnHijack(t *testing.T) {
 	t.Parallel()
 
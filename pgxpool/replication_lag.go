@@ -0,0 +1,224 @@
+package pgxpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+)
+
+// ErrReplicationLag is wrapped by the error returned when a connection is not established because the replication lag
+// of its host exceeds Config.MaxReplicationLag.
+var ErrReplicationLag = errors.New("replication lag exceeds MaxReplicationLag")
+
+// replicationLagSQL selects the last WAL location replayed by a standby and its replication lag in seconds. The lag is
+// 0 if the WAL receiver is streaming and all received WAL has been replayed. An idle primary commits nothing so the time
+// since the last replayed transaction alone would overstate the lag. Otherwise the lag is the time since the last
+// replayed transaction was committed on the primary. A standby whose WAL receiver is disconnected stops receiving WAL so
+// its receive and replay locations are equal no matter how far behind it is. The status of the WAL receiver is only
+// visible to roles with the privileges of pg_read_all_stats. For other roles the lag is always the time since the last
+// replayed transaction. Both are null when the server is not a standby.
+const replicationLagSQL = `select
+	pg_last_wal_replay_lsn()::text,
+	case
+		when pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+			and exists (select 1 from pg_stat_wal_receiver where status = 'streaming') then 0
+		else extract(epoch from now() - pg_last_xact_replay_timestamp())::float8
+	end`
+
+// HostReplicationLag is the replication lag of a host last measured by the pool. See Config.MaxReplicationLag.
+type HostReplicationLag struct {
+	// Host is the address of the host.
+	Host string
+
+	// Standby is true if the host is a standby.
+	Standby bool
+
+	// Lag is the replication lag of the host. It is 0 if the host is not a standby.
+	Lag time.Duration
+
+	// ReplayLSN is the last WAL location replayed by the host (e.g. "0/3000148"). It is empty if the host is not a
+	// standby.
+	ReplayLSN string
+
+	// Excluded is true if Lag exceeds Config.MaxReplicationLag. Connections to the host are not used until a measurement
+	// is at or below Config.MaxReplicationLag.
+	Excluded bool
+
+	// MeasuredAt is the time of the measurement.
+	MeasuredAt time.Time
+}
+
+// replicationLagMonitor records the replication lag of each host the pool connects to and excludes hosts whose lag
+// exceeds maxLag.
+type replicationLagMonitor struct {
+	maxLag time.Duration
+
+	mux   sync.Mutex
+	hosts map[string]*HostReplicationLag
+}
+
+func newReplicationLagMonitor(maxLag time.Duration) *replicationLagMonitor {
+	return &replicationLagMonitor{
+		maxLag: maxLag,
+		hosts:  make(map[string]*HostReplicationLag),
+	}
+}
+
+// measure measures and records the replication lag of the host of pgConn. It returns an error wrapping
+// ErrReplicationLag if the host is excluded.
+func (m *replicationLagMonitor) measure(ctx context.Context, pgConn *pgconn.PgConn) error {
+	hostLag, err := measureReplicationLag(ctx, pgConn)
+	if err != nil {
+		return err
+	}
+
+	return m.record(hostLag)
+}
+
+// record records hostLag. It returns an error wrapping ErrReplicationLag if the host is excluded.
+func (m *replicationLagMonitor) record(hostLag HostReplicationLag) error {
+	hostLag.Excluded = hostLag.Lag > m.maxLag
+
+	m.mux.Lock()
+	m.hosts[hostLag.Host] = &hostLag
+	m.mux.Unlock()
+
+	if hostLag.Excluded {
+		return fmt.Errorf("%s: %w: %v > %v", hostLag.Host, ErrReplicationLag, hostLag.Lag, m.maxLag)
+	}
+	return nil
+}
+
+// excluded checks if the last measurement of host exceeded maxLag.
+func (m *replicationLagMonitor) excluded(host string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	hostLag, ok := m.hosts[host]
+	return ok && hostLag.Excluded
+}
+
+// stats returns the last measurement of each host ordered by host.
+func (m *replicationLagMonitor) stats() []HostReplicationLag {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	stats := make([]HostReplicationLag, 0, len(m.hosts))
+	for _, hostLag := range m.hosts {
+		stats = append(stats, *hostLag)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+
+	return stats
+}
+
+// measureReplicationLag measures the replication lag of the host pgConn is connected to. Excluded is always false in
+// the result.
+func measureReplicationLag(ctx context.Context, pgConn *pgconn.PgConn) (HostReplicationLag, error) {
+	results, err := pgConn.Exec(ctx, replicationLagSQL).ReadAll()
+	if err != nil {
+		return HostReplicationLag{}, err
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 2 {
+		return HostReplicationLag{}, errors.New("unexpected result measuring replication lag")
+	}
+
+	row := results[0].Rows[0]
+	hostLag := HostReplicationLag{Host: connHost(pgConn), MeasuredAt: time.Now()}
+	if row[0] != nil {
+		hostLag.Standby = true
+		hostLag.ReplayLSN = string(row[0])
+	}
+	if row[1] != nil {
+		lagSeconds, err := strconv.ParseFloat(string(row[1]), 64)
+		if err != nil {
+			return HostReplicationLag{}, fmt.Errorf("cannot parse replication lag: %w", err)
+		}
+		hostLag.Lag = time.Duration(lagSeconds * float64(time.Second))
+	}
+
+	return hostLag, nil
+}
+
+// connHost returns the address of the host pgConn is connected to.
+func connHost(pgConn *pgconn.PgConn) string {
+	return pgConn.Conn().RemoteAddr().String()
+}
+
+// checkReplicationLag measures the replication lag of each host. A host with idle connections is measured with one of
+// them. The other idle connections are released right away so Acquire can use them. Idle connections to excluded hosts
+// and connections that fail to measure are destroyed. An excluded host without idle connections is measured with a
+// dedicated connection so it is used again as soon as it catches up.
+func (p *Pool) checkReplicationLag() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthCheckPeriod)
+	defer cancel()
+
+	measuring := make(map[string]*puddle.Resource[*connResource])
+	for _, res := range p.p.AcquireAllIdle() {
+		host := res.Value().host
+		if _, ok := measuring[host]; !ok {
+			measuring[host] = res
+		} else if p.replicationLag.excluded(host) {
+			res.Destroy()
+		} else {
+			res.ReleaseUnused()
+		}
+	}
+
+	for _, res := range measuring {
+		err := p.replicationLag.measure(ctx, res.Value().conn.PgConn())
+		if err != nil {
+			// Other connections to a host that is now excluded are destroyed when they are acquired.
+			res.Destroy()
+		} else {
+			res.ReleaseUnused()
+		}
+	}
+
+	for _, hostLag := range p.replicationLag.stats() {
+		if _, ok := measuring[hostLag.Host]; !ok && hostLag.Excluded {
+			p.measureHost(ctx, hostLag.Host)
+		}
+	}
+}
+
+// measureHost measures the replication lag of host with a dedicated connection that is not added to the pool. The
+// connection is established like the connections of the pool except that all other hosts are skipped.
+func (p *Pool) measureHost(ctx context.Context, host string) {
+	connConfig := p.config.ConnConfig.Copy()
+	if p.beforeConnect != nil {
+		if err := p.beforeConnect(ctx, connConfig); err != nil {
+			return
+		}
+	}
+
+	dialFunc := connConfig.DialFunc
+	connConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialFunc(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if conn.RemoteAddr().String() != host {
+			conn.Close()
+			return nil, fmt.Errorf("%s is not the host being measured", addr)
+		}
+		return conn, nil
+	}
+
+	pgConn, err := pgconn.ConnectConfig(ctx, &connConfig.Config)
+	if err != nil {
+		// The host remains excluded until it can be measured.
+		return
+	}
+	defer pgConn.Close(ctx)
+
+	p.replicationLag.measure(ctx, pgConn)
+}
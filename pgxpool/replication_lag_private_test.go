@@ -0,0 +1,37 @@
+package pgxpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationLagMonitorExcludesLaggingHosts(t *testing.T) {
+	t.Parallel()
+
+	m := newReplicationLagMonitor(10 * time.Second)
+	assert.False(t, m.excluded("b:5432"))
+
+	err := m.record(HostReplicationLag{Host: "b:5432", Standby: true, Lag: 12 * time.Second, ReplayLSN: "0/3000148"})
+	require.ErrorIs(t, err, ErrReplicationLag)
+	assert.True(t, m.excluded("b:5432"))
+
+	err = m.record(HostReplicationLag{Host: "a:5432"})
+	require.NoError(t, err)
+	assert.False(t, m.excluded("a:5432"))
+
+	stats := m.stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "a:5432", stats[0].Host)
+	assert.False(t, stats[0].Excluded)
+	assert.Equal(t, "b:5432", stats[1].Host)
+	assert.True(t, stats[1].Excluded)
+	assert.Equal(t, 12*time.Second, stats[1].Lag)
+
+	// The host is used again when it catches up.
+	err = m.record(HostReplicationLag{Host: "b:5432", Standby: true, Lag: 10 * time.Second, ReplayLSN: "0/3000200"})
+	require.NoError(t, err)
+	assert.False(t, m.excluded("b:5432"))
+}
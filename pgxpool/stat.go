@@ -12,6 +12,10 @@ type Stat struct {
 	newConnsCount        int64
 	lifetimeDestroyCount int64
 	idleDestroyCount     int64
+	rejectedAcquireCount int64
+	waitingAcquires      int32
+	acquireClassStats    []AcquireClassStat
+	hostReplicationLags  []HostReplicationLag
 }
 
 // AcquireCount returns the cumulative count of successful acquires from the pool.
@@ -82,3 +86,27 @@ func (s *Stat) MaxLifetimeDestroyCount() int64 {
 func (s *Stat) MaxIdleDestroyCount() int64 {
 	return s.idleDestroyCount
 }
+
+// RejectedAcquireCount returns the cumulative count of acquires that failed with ErrPoolExhausted because
+// MaxWaitingAcquires or MaxAcquireWait was exceeded.
+func (s *Stat) RejectedAcquireCount() int64 {
+	return s.rejectedAcquireCount
+}
+
+// WaitingAcquires returns the number of Acquire calls currently waiting for a connection to be released. Acquire calls
+// are only counted if the pool has AcquireClasses or MaxWaitingAcquires or MaxAcquireWait is set.
+func (s *Stat) WaitingAcquires() int32 {
+	return s.waitingAcquires
+}
+
+// AcquireClassStats returns the statistics of each AcquireClass ordered by name. The class named "" is included. It
+// returns nil if the pool has no AcquireClasses.
+func (s *Stat) AcquireClassStats() []AcquireClassStat {
+	return s.acquireClassStats
+}
+
+// HostReplicationLags returns the last measured replication lag of each host ordered by host. It returns nil if
+// Config.MaxReplicationLag is 0.
+func (s *Stat) HostReplicationLags() []HostReplicationLag {
+	return s.hostReplicationLags
+}
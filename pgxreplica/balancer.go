@@ -0,0 +1,40 @@
+package pgxreplica
+
+import (
+	"sync/atomic"
+)
+
+// Balancer chooses the replica that is used for a read.
+type Balancer interface {
+	// Choose returns one of replicas. replicas only contains healthy replicas and is never empty. Choose may be called
+	// concurrently.
+	Choose(replicas []*Replica) *Replica
+}
+
+// RoundRobinBalancer chooses each replica in turn. It is the default Balancer.
+type RoundRobinBalancer struct {
+	n atomic.Uint64
+}
+
+// Choose implements the Balancer interface.
+func (b *RoundRobinBalancer) Choose(replicas []*Replica) *Replica {
+	n := b.n.Add(1) - 1
+	return replicas[n%uint64(len(replicas))]
+}
+
+// LeastBusyBalancer chooses the replica with the fewest acquired connections.
+type LeastBusyBalancer struct{}
+
+// Choose implements the Balancer interface.
+func (LeastBusyBalancer) Choose(replicas []*Replica) *Replica {
+	chosen := replicas[0]
+	chosenAcquired := chosen.pool.Stat().AcquiredConns()
+	for _, r := range replicas[1:] {
+		acquired := r.pool.Stat().AcquiredConns()
+		if acquired < chosenAcquired {
+			chosen = r
+			chosenAcquired = acquired
+		}
+	}
+	return chosen
+}
@@ -0,0 +1,474 @@
+// Package pgxreplica is a connection pool that sends writes to a primary server and reads to replicas.
+//
+// A Pool holds a pgxpool.Pool for the primary and one for each replica. Exec, SendBatch, CopyFrom, Begin, and
+// read-write transactions use the primary. Query, QueryRow, and read-only transactions use a replica chosen by the
+// Balancer. A replica that cannot be connected to or fails a health check is ejected. It is not used for reads until it
+// passes a health check again. Reads use the primary when no replica is healthy.
+//
+// Set pgxpool.Config.MaxReplicationLag in the configuration of a replica to eject the replica while its pool excludes
+// its host because of replication lag. The replica is used again when the pool measures that it has caught up.
+//
+//	pool, err := pgxreplica.New(ctx, "host=primary.example.com", "host=replica1.example.com", "host=replica2.example.com")
+//	if err != nil {
+//		// ...
+//	}
+//	defer pool.Close()
+//
+//	_, err = pool.Exec(ctx, "insert into widgets(name) values($1)", "foo") // primary
+//	rows, err := pool.Query(ctx, "select name from widgets")              // replica
+package pgxreplica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultHealthCheckPeriod is the duration between health checks of the replicas when Config.HealthCheckPeriod is 0.
+const DefaultHealthCheckPeriod = 10 * time.Second
+
+// Config is the configuration for creating a Pool.
+type Config struct {
+	// Primary is the configuration of the primary pool.
+	Primary *pgxpool.Config
+
+	// Replicas are the configurations of the replica pools.
+	Replicas []*pgxpool.Config
+
+	// Balancer chooses the replica for each read. If it is nil a RoundRobinBalancer is used.
+	Balancer Balancer
+
+	// HealthCheckPeriod is the duration between health checks of the replicas. A health check uses a dedicated
+	// connection to each replica that is not part of the replica's pool so a busy pool does not fail the check. The
+	// connection is validated by the ValidateConnect function of the replica's ConnConfig. The replica is also ejected
+	// while its pool excludes the host of the connection because of pgxpool.Config.MaxReplicationLag. If it is 0
+	// DefaultHealthCheckPeriod is used.
+	HealthCheckPeriod time.Duration
+}
+
+// ParseConfig builds a Config from a primary connection string and replica connection strings. Each connection string
+// is parsed with pgxpool.ParseConfig. Connections to the primary are validated as with target_session_attrs=primary
+// and connections to the replicas as with target_session_attrs=standby unless the connection string sets
+// target_session_attrs to something other than any. Set ConnConfig.ValidateConnect to nil to disable validation.
+func ParseConfig(primaryConnString string, replicaConnStrings ...string) (*Config, error) {
+	primary, err := pgxpool.ParseConfig(primaryConnString)
+	if err != nil {
+		return nil, err
+	}
+	if primary.ConnConfig.ValidateConnect == nil {
+		primary.ConnConfig.ValidateConnect = pgconn.ValidateConnectTargetSessionAttrsPrimary
+	}
+
+	config := &Config{Primary: primary}
+	for _, connString := range replicaConnStrings {
+		replica, err := pgxpool.ParseConfig(connString)
+		if err != nil {
+			return nil, err
+		}
+		if replica.ConnConfig.ValidateConnect == nil {
+			replica.ConnConfig.ValidateConnect = pgconn.ValidateConnectTargetSessionAttrsStandby
+		}
+		config.Replicas = append(config.Replicas, replica)
+	}
+
+	return config, nil
+}
+
+// Replica is a replica of a Pool.
+type Replica struct {
+	pool          *pgxpool.Pool
+	connConfig    *pgx.ConnConfig
+	beforeConnect func(context.Context, *pgx.ConnConfig) error
+	healthConn    *pgconn.PgConn // Only used by the health check.
+
+	mux       sync.Mutex
+	err       error // The reason the replica is ejected. nil when the replica is healthy.
+	lag       time.Duration
+	replayLSN string
+}
+
+// Pool returns the pool of the replica.
+func (r *Replica) Pool() *pgxpool.Pool {
+	return r.pool
+}
+
+// Healthy returns true if the replica is used for reads.
+func (r *Replica) Healthy() bool {
+	return r.Err() == nil
+}
+
+// Err returns the error that caused the replica to be ejected. It is nil if the replica is healthy.
+func (r *Replica) Err() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.err
+}
+
+func (r *Replica) setErr(err error) {
+	r.mux.Lock()
+	r.err = err
+	r.mux.Unlock()
+}
+
+// Lag returns the replication lag of the replica as last measured by its pool and seen by a health check. It is 0 if it
+// has not been measured, the replica is not a standby, or pgxpool.Config.MaxReplicationLag of the replica is 0.
+func (r *Replica) Lag() time.Duration {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.lag
+}
+
+// ReplayLSN returns the last WAL location replayed by the replica (e.g. "0/3000148") as last measured by its pool and
+// seen by a health check. It is empty in the same cases Lag is 0.
+func (r *Replica) ReplayLSN() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.replayLSN
+}
+
+// check validates the health connection. It ejects the replica if the check fails or the replica's pool excludes the
+// host of the health connection because of its replication lag. Otherwise the replica is restored.
+func (r *Replica) check(ctx context.Context) {
+	err := r.connectHealthConn(ctx)
+
+	var hostLag pgxpool.HostReplicationLag
+	if err == nil {
+		hostLag = r.hostReplicationLag()
+		if hostLag.Excluded {
+			err = fmt.Errorf("pgxreplica: %s: %w: %v", hostLag.Host, pgxpool.ErrReplicationLag, hostLag.Lag)
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.err = err
+	if err == nil || errors.Is(err, pgxpool.ErrReplicationLag) {
+		r.lag = hostLag.Lag
+		r.replayLSN = hostLag.ReplayLSN
+	}
+}
+
+// hostReplicationLag returns the replication lag the replica's pool last measured for the host of the health
+// connection. It is the zero value if the pool has not measured it.
+func (r *Replica) hostReplicationLag() pgxpool.HostReplicationLag {
+	host := r.healthConn.Conn().RemoteAddr().String()
+	for _, hostLag := range r.pool.Stat().HostReplicationLags() {
+		if hostLag.Host == host {
+			return hostLag
+		}
+	}
+	return pgxpool.HostReplicationLag{}
+}
+
+// connectHealthConn establishes the health connection if it is not open. ValidateConnect is called when it is
+// established. An open connection is validated again as the role of the server may have changed.
+func (r *Replica) connectHealthConn(ctx context.Context) error {
+	if r.healthConn != nil && !r.healthConn.IsClosed() {
+		if r.connConfig.ValidateConnect != nil {
+			err := r.connConfig.ValidateConnect(ctx, r.healthConn)
+			if err != nil {
+				r.closeHealthConn()
+				return err
+			}
+		}
+		return nil
+	}
+
+	connConfig := r.connConfig.Copy()
+	if r.beforeConnect != nil {
+		err := r.beforeConnect(ctx, connConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	healthConn, err := pgconn.ConnectConfig(ctx, &connConfig.Config)
+	if err != nil {
+		return err
+	}
+	r.healthConn = healthConn
+
+	return nil
+}
+
+func (r *Replica) closeHealthConn() {
+	if r.healthConn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	r.healthConn.Close(ctx)
+	r.healthConn = nil
+}
+
+// Pool sends writes to a primary pool and reads to replica pools. It is safe for concurrent use.
+type Pool struct {
+	primary           *pgxpool.Pool
+	replicas          []*Replica
+	balancer          Balancer
+	healthCheckPeriod time.Duration
+
+	closeOnce       sync.Once
+	closeChan       chan struct{}
+	healthCheckDone chan struct{} // nil if there is no background health check.
+}
+
+// New creates a new Pool. See ParseConfig for information on the connection strings.
+func New(ctx context.Context, primaryConnString string, replicaConnStrings ...string) (*Pool, error) {
+	config, err := ParseConfig(primaryConnString, replicaConnStrings...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithConfig(ctx, config)
+}
+
+// NewWithConfig creates a new Pool. Like pgxpool.NewWithConfig it returns without waiting for any connections to be
+// established.
+func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
+	if config.Primary == nil {
+		return nil, errors.New("pgxreplica: Primary config is required")
+	}
+
+	p := &Pool{
+		balancer:          config.Balancer,
+		healthCheckPeriod: config.HealthCheckPeriod,
+		closeChan:         make(chan struct{}),
+	}
+	if p.balancer == nil {
+		p.balancer = &RoundRobinBalancer{}
+	}
+	if p.healthCheckPeriod == 0 {
+		p.healthCheckPeriod = DefaultHealthCheckPeriod
+	}
+
+	var err error
+	p.primary, err = pgxpool.NewWithConfig(ctx, config.Primary)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, replicaConfig := range config.Replicas {
+		pool, err := pgxpool.NewWithConfig(ctx, replicaConfig)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.replicas = append(p.replicas, &Replica{
+			pool:          pool,
+			connConfig:    replicaConfig.ConnConfig.Copy(),
+			beforeConnect: replicaConfig.BeforeConnect,
+		})
+	}
+
+	if len(p.replicas) > 0 {
+		p.healthCheckDone = make(chan struct{})
+		go p.backgroundHealthCheck()
+	}
+
+	return p, nil
+}
+
+// Close closes the primary and replica pools. It blocks until all connections are returned to their pools and closed.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closeChan)
+		if p.healthCheckDone != nil {
+			<-p.healthCheckDone
+		}
+		if p.primary != nil {
+			p.primary.Close()
+		}
+		for _, r := range p.replicas {
+			r.closeHealthConn()
+			r.pool.Close()
+		}
+	})
+}
+
+func (p *Pool) backgroundHealthCheck() {
+	defer close(p.healthCheckDone)
+
+	ticker := time.NewTicker(p.healthCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closeChan:
+			return
+		case <-ticker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+// checkHealth checks all replicas concurrently. Ejected replicas that pass the check are used again.
+func (p *Pool) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthCheckPeriod)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for _, r := range p.replicas {
+		wg.Add(1)
+		go func(r *Replica) {
+			defer wg.Done()
+			r.check(ctx)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// chooseReplica returns the replica to use for a read. It returns nil if no replica is healthy.
+func (p *Pool) chooseReplica() *Replica {
+	healthy := make([]*Replica, 0, len(p.replicas))
+	for _, r := range p.replicas {
+		if r.Healthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	return p.balancer.Choose(healthy)
+}
+
+// read calls f with the pool of a replica or with the primary pool if no replica is healthy. If f fails to connect to
+// the replica the replica is ejected and f is called again. Nothing has been sent to the server when connecting fails
+// so this is always safe.
+func (p *Pool) read(f func(pool *pgxpool.Pool) error) error {
+	for {
+		r := p.chooseReplica()
+		if r == nil {
+			return f(p.primary)
+		}
+
+		err := f(r.pool)
+		var connectErr *pgconn.ConnectError
+		if !errors.As(err, &connectErr) {
+			return err
+		}
+		r.setErr(err)
+	}
+}
+
+// Primary returns the primary pool.
+func (p *Pool) Primary() *pgxpool.Pool {
+	return p.primary
+}
+
+// Replicas returns the replicas in the order of Config.Replicas.
+func (p *Pool) Replicas() []*Replica {
+	replicas := make([]*Replica, len(p.replicas))
+	copy(replicas, p.replicas)
+	return replicas
+}
+
+// Stat returns a snapshot of the statistics of the primary and replica pools.
+func (p *Pool) Stat() *Stat {
+	s := &Stat{primary: p.primary.Stat()}
+	for _, r := range p.replicas {
+		r.mux.Lock()
+		s.replicas = append(s.replicas, &ReplicaStat{
+			pool:      r.pool.Stat(),
+			healthy:   r.err == nil,
+			err:       r.err,
+			lag:       r.lag,
+			replayLSN: r.replayLSN,
+		})
+		r.mux.Unlock()
+	}
+	return s
+}
+
+// Acquire returns a connection from the primary pool.
+func (p *Pool) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return p.primary.Acquire(ctx)
+}
+
+// AcquireRead returns a connection from a replica. It returns a connection from the primary pool if no replica is
+// healthy.
+func (p *Pool) AcquireRead(ctx context.Context) (*pgxpool.Conn, error) {
+	var c *pgxpool.Conn
+	err := p.read(func(pool *pgxpool.Pool) error {
+		var err error
+		c, err = pool.Acquire(ctx)
+		return err
+	})
+	return c, err
+}
+
+// Exec executes sql on the primary. See pgxpool.Pool.Exec.
+func (p *Pool) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return p.primary.Exec(ctx, sql, arguments...)
+}
+
+// Query executes sql on a replica. See pgxpool.Pool.Query.
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := p.read(func(pool *pgxpool.Pool) error {
+		var err error
+		rows, err = pool.Query(ctx, sql, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow executes sql on a replica. See pgxpool.Pool.QueryRow.
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	c, err := p.AcquireRead(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &connRow{r: c.QueryRow(ctx, sql, args...), c: c}
+}
+
+// SendBatch sends b to the primary. See pgxpool.Pool.SendBatch.
+func (p *Pool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return p.primary.SendBatch(ctx, b)
+}
+
+// Begin starts a transaction on the primary. See pgxpool.Pool.Begin.
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return p.primary.Begin(ctx)
+}
+
+// BeginTx starts a transaction. Transactions with the pgx.ReadOnly access mode are started on a replica. Other
+// transactions are started on the primary. See pgxpool.Pool.BeginTx.
+func (p *Pool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	if txOptions.AccessMode != pgx.ReadOnly {
+		return p.primary.BeginTx(ctx, txOptions)
+	}
+
+	var tx pgx.Tx
+	err := p.read(func(pool *pgxpool.Pool) error {
+		var err error
+		tx, err = pool.BeginTx(ctx, txOptions)
+		return err
+	})
+	return tx, err
+}
+
+// CopyFrom copies rows to the primary. See pgxpool.Pool.CopyFrom.
+func (p *Pool) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return p.primary.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// Ping pings the primary. See pgxpool.Pool.Ping.
+func (p *Pool) Ping(ctx context.Context) error {
+	return p.primary.Ping(ctx)
+}
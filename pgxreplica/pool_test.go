@@ -0,0 +1,296 @@
+package pgxreplica_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/internal/pgmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgxreplica"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableConnString refers to a port that nothing listens on.
+const unreachableConnString = "host=127.0.0.1 port=1 connect_timeout=1"
+
+func funcPointer(f any) uintptr {
+	return reflect.ValueOf(f).Pointer()
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := pgxreplica.ParseConfig("host=primary", "host=replica1", "host=replica2 target_session_attrs=read-only")
+	require.NoError(t, err)
+
+	assert.Equal(t, "primary", config.Primary.ConnConfig.Host)
+	assert.Equal(t, funcPointer(pgconn.ValidateConnectTargetSessionAttrsPrimary), funcPointer(config.Primary.ConnConfig.ValidateConnect))
+
+	require.Len(t, config.Replicas, 2)
+	assert.Equal(t, "replica1", config.Replicas[0].ConnConfig.Host)
+	assert.Equal(t, funcPointer(pgconn.ValidateConnectTargetSessionAttrsStandby), funcPointer(config.Replicas[0].ConnConfig.ValidateConnect))
+	assert.Equal(t, "replica2", config.Replicas[1].ConnConfig.Host)
+	assert.Equal(t, funcPointer(pgconn.ValidateConnectTargetSessionAttrsReadOnly), funcPointer(config.Replicas[1].ConnConfig.ValidateConnect))
+
+	_, err = pgxreplica.ParseConfig("host=primary", "invalid")
+	require.Error(t, err)
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	t.Parallel()
+
+	pool, err := pgxreplica.New(context.Background(), unreachableConnString, unreachableConnString, unreachableConnString)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	replicas := pool.Replicas()
+	b := &pgxreplica.RoundRobinBalancer{}
+	assert.Same(t, replicas[0], b.Choose(replicas))
+	assert.Same(t, replicas[1], b.Choose(replicas))
+	assert.Same(t, replicas[0], b.Choose(replicas))
+	assert.Same(t, replicas[1], b.Choose(replicas[:2]))
+}
+
+func TestReadEjectsUnreachableReplica(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxreplica.New(ctx, unreachableConnString, unreachableConnString)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	replica := pool.Replicas()[0]
+	require.True(t, replica.Healthy())
+
+	// The replica is ejected and the query is retried on the primary, which is also unreachable.
+	_, err = pool.Query(ctx, "select 1")
+	var connectErr *pgconn.ConnectError
+	require.ErrorAs(t, err, &connectErr)
+
+	assert.False(t, replica.Healthy())
+	stat := pool.Stat()
+	require.Len(t, stat.Replicas(), 1)
+	assert.False(t, stat.Replicas()[0].Healthy())
+	assert.ErrorAs(t, stat.Replicas()[0].Err(), &connectErr)
+	assert.EqualValues(t, 1, stat.Replicas()[0].Pool().NewConnsCount())
+	assert.EqualValues(t, 1, stat.Primary().NewConnsCount())
+}
+
+func newTestConfig(t *testing.T) *pgxreplica.Config {
+	connString := os.Getenv("PGX_TEST_DATABASE")
+	config, err := pgxreplica.ParseConfig(connString, connString, connString)
+	require.NoError(t, err)
+
+	// The test database is not a replica.
+	config.Primary.ConnConfig.ValidateConnect = nil
+	for _, replica := range config.Replicas {
+		replica.ConnConfig.ValidateConnect = nil
+	}
+	return config
+}
+
+func TestPoolSplitsReadsAndWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	pool, err := pgxreplica.NewWithConfig(ctx, newTestConfig(t))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	_, err = pool.Exec(ctx, "select 1")
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		var n int32
+		err = pool.QueryRow(ctx, "select $1::int4", i).Scan(&n)
+		require.NoError(t, err)
+		assert.EqualValues(t, i, n)
+	}
+
+	rows, err := pool.Query(ctx, "select generate_series(1, 3)")
+	require.NoError(t, err)
+	ns, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+	require.NoError(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, ns)
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+
+	stat := pool.Stat()
+	assert.EqualValues(t, 1, stat.Primary().AcquireCount())
+	assert.EqualValues(t, 3, stat.Replicas()[0].Pool().AcquireCount())
+	assert.EqualValues(t, 3, stat.Replicas()[1].Pool().AcquireCount())
+	for _, r := range stat.Replicas() {
+		assert.EqualValues(t, 0, r.Pool().AcquiredConns())
+	}
+}
+
+func TestLeastBusyBalancer(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config := newTestConfig(t)
+	config.Balancer = pgxreplica.LeastBusyBalancer{}
+	pool, err := pgxreplica.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	c1, err := pool.AcquireRead(ctx)
+	require.NoError(t, err)
+	defer c1.Release()
+	c2, err := pool.AcquireRead(ctx)
+	require.NoError(t, err)
+	defer c2.Release()
+
+	for _, r := range pool.Stat().Replicas() {
+		assert.EqualValues(t, 1, r.Pool().AcquiredConns())
+	}
+}
+
+func TestPoolRestoresReplicaAfterHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	config := newTestConfig(t)
+	config.Replicas = config.Replicas[:1]
+	config.HealthCheckPeriod = 50 * time.Millisecond
+
+	var unhealthy atomic.Bool
+	unhealthy.Store(true)
+	config.Replicas[0].ConnConfig.ValidateConnect = func(ctx context.Context, pgConn *pgconn.PgConn) error {
+		if unhealthy.Load() {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+
+	pool, err := pgxreplica.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// The read falls back to the primary.
+	var n int32
+	err = pool.QueryRow(ctx, "select 1").Scan(&n)
+	require.NoError(t, err)
+	replica := pool.Replicas()[0]
+	require.False(t, replica.Healthy())
+
+	unhealthy.Store(false)
+	require.Eventually(t, replica.Healthy, 5*time.Second, 10*time.Millisecond)
+}
+
+// startLaggingReplica starts a mock standby that reports a replication lag of lag seconds for each query. It returns
+// the connection string of the standby.
+func startLaggingReplica(t *testing.T, replayLSN, lag string) string {
+	ln, err := pgmock.StartStandby(replayLSN, lag)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := strings.Cut(ln.Addr().String(), ":")
+	return fmt.Sprintf("host=%s port=%s sslmode=disable default_query_exec_mode=simple_protocol", host, port)
+}
+
+func TestPoolEjectsLaggingReplica(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config, err := pgxreplica.ParseConfig(unreachableConnString, startLaggingReplica(t, "0/3000148", "12.5"))
+	require.NoError(t, err)
+	config.Replicas[0].ConnConfig.ValidateConnect = nil
+	config.Replicas[0].MaxReplicationLag = 10 * time.Second
+	config.HealthCheckPeriod = 50 * time.Millisecond
+
+	pool, err := pgxreplica.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// The replica pool refuses to connect to the lagging host so the read falls back to the unreachable primary.
+	_, err = pool.Query(ctx, "select 1")
+	require.Error(t, err)
+
+	var stat *pgxreplica.ReplicaStat
+	require.Eventually(t, func() bool {
+		stat = pool.Stat().Replicas()[0]
+		return stat.Lag() != 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, stat.Err(), pgxpool.ErrReplicationLag)
+	assert.False(t, stat.Healthy())
+	assert.Equal(t, 12500*time.Millisecond, stat.Lag())
+	assert.Equal(t, "0/3000148", stat.ReplayLSN())
+	assert.False(t, pool.Replicas()[0].Healthy())
+}
+
+func TestPoolReportsReplicaLag(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config, err := pgxreplica.ParseConfig(unreachableConnString, startLaggingReplica(t, "0/3000148", "0.25"))
+	require.NoError(t, err)
+	config.Replicas[0].ConnConfig.ValidateConnect = nil
+	config.Replicas[0].MaxReplicationLag = 10 * time.Second
+	config.Replicas[0].MinConns = 1
+	config.HealthCheckPeriod = 50 * time.Millisecond
+
+	pool, err := pgxreplica.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	replica := pool.Replicas()[0]
+	require.Eventually(t, func() bool { return replica.ReplayLSN() != "" }, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, replica.Healthy())
+	assert.Equal(t, 250*time.Millisecond, replica.Lag())
+	assert.Equal(t, "0/3000148", replica.ReplayLSN())
+}
+
+func TestPoolHealthCheckDoesNotUseReplicaPool(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	config, err := pgxreplica.ParseConfig(unreachableConnString, startLaggingReplica(t, "0/3000148", "0.25"))
+	require.NoError(t, err)
+	config.Replicas[0].ConnConfig.ValidateConnect = nil
+	config.Replicas[0].MaxConns = 1
+	config.Replicas[0].MaxReplicationLag = 10 * time.Second
+	config.HealthCheckPeriod = 50 * time.Millisecond
+
+	pool, err := pgxreplica.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// The only connection of the replica pool is busy.
+	c, err := pool.AcquireRead(ctx)
+	require.NoError(t, err)
+	defer c.Release()
+
+	replica := pool.Replicas()[0]
+	require.Eventually(t, func() bool { return replica.ReplayLSN() != "" }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, replica.Healthy())
+	assert.EqualValues(t, 1, replica.Pool().Stat().TotalConns())
+}
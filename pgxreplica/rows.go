@@ -0,0 +1,35 @@
+package pgxreplica
+
+import (
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type errRow struct {
+	err error
+}
+
+func (e errRow) Scan(dest ...any) error { return e.err }
+
+// connRow releases its connection when it is scanned.
+type connRow struct {
+	r pgx.Row
+	c *pgxpool.Conn
+}
+
+func (row *connRow) Scan(dest ...any) error {
+	panicked := true
+	defer func() {
+		if panicked && row.c != nil {
+			row.c.Release()
+			row.c = nil
+		}
+	}()
+	err := row.r.Scan(dest...)
+	panicked = false
+	if row.c != nil {
+		row.c.Release()
+		row.c = nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package pgxreplica
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Stat is a snapshot of Pool statistics.
+type Stat struct {
+	primary  *pgxpool.Stat
+	replicas []*ReplicaStat
+}
+
+// Primary returns the statistics of the primary pool.
+func (s *Stat) Primary() *pgxpool.Stat {
+	return s.primary
+}
+
+// Replicas returns the statistics of each replica in the order of Config.Replicas.
+func (s *Stat) Replicas() []*ReplicaStat {
+	return s.replicas
+}
+
+// ReplicaStat is a snapshot of the statistics of one replica.
+type ReplicaStat struct {
+	pool      *pgxpool.Stat
+	healthy   bool
+	err       error
+	lag       time.Duration
+	replayLSN string
+}
+
+// Pool returns the statistics of the replica's pool.
+func (s *ReplicaStat) Pool() *pgxpool.Stat {
+	return s.pool
+}
+
+// Healthy returns true if the replica is used for reads.
+func (s *ReplicaStat) Healthy() bool {
+	return s.healthy
+}
+
+// Err returns the error that caused the replica to be ejected. It is nil if the replica is healthy.
+func (s *ReplicaStat) Err() error {
+	return s.err
+}
+
+// Lag returns the replication lag of the replica. See Replica.Lag.
+func (s *ReplicaStat) Lag() time.Duration {
+	return s.lag
+}
+
+// ReplayLSN returns the last WAL location replayed by the replica. See Replica.ReplayLSN.
+func (s *ReplicaStat) ReplayLSN() string {
+	return s.replayLSN
+}
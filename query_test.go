@@ -240,6 +240,61 @@ func TestConnQueryArgsAndScanWithUnregisteredOID(t *testing.T) {
 	})
 }
 
+func TestConnQueryFetchSize(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	modes := []pgx.QueryExecMode{
+		pgx.QueryExecModeCacheStatement,
+		pgx.QueryExecModeCacheDescribe,
+		pgx.QueryExecModeDescribeExec,
+		pgx.QueryExecModeExec,
+	}
+
+	pgxtest.RunWithQueryExecModes(ctx, t, defaultConnTestRunner, modes, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+		_, err := conn.Query(ctx, "select generate_series(1, 10)", pgx.QueryFetchSize(3))
+		require.ErrorContains(t, err, "requires a transaction")
+
+		tx, err := conn.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		rows, err := tx.Query(ctx, "select n, 'n' || n as s from generate_series(1, $1) n", pgx.QueryFetchSize(3), 10)
+		require.NoError(t, err)
+		type row struct {
+			N int32
+			S string
+		}
+		result, err := pgx.CollectRows(rows, pgx.RowToStructByName[row])
+		require.NoError(t, err)
+		require.Len(t, result, 10)
+		for i, r := range result {
+			require.Equal(t, int32(i+1), r.N)
+			require.Equal(t, fmt.Sprintf("n%d", i+1), r.S)
+		}
+		// The command tag counts the rows of all fetches, not only the last one.
+		require.Equal(t, "SELECT 10", rows.CommandTag().String())
+		require.EqualValues(t, 10, rows.CommandTag().RowsAffected())
+
+		// Closing rows early closes the portal.
+		rows, err = tx.Query(ctx, "select generate_series(1, 10)", pgx.QueryFetchSize(3))
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			require.True(t, rows.Next())
+		}
+		rows.Close()
+		require.NoError(t, rows.Err())
+		assert.Equal(t, "SELECT 4", rows.CommandTag().String())
+
+		var n int32
+		err = tx.QueryRow(ctx, "select generate_series(5, 10)", pgx.QueryFetchSize(2)).Scan(&n)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, n)
+	})
+}
+
 // https://github.com/jackc/pgx/issues/478
 func TestConnQueryReadRowMultipleTimes(t *testing.T) {
 	t.Parallel()
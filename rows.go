@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -138,6 +139,12 @@ type baseRows struct {
 	conn              *Conn
 	multiResultReader *pgconn.MultiResultReader
 
+	// portalName and fetchSize are set when the query is read from a portal QueryFetchSize rows at a time.
+	portalName string
+	fetchSize  uint32
+	// portalRowCount is the number of rows read from portal fetches before the current one.
+	portalRowCount int64
+
 	queryTracer QueryTracer
 	batchTracer BatchTracer
 	ctx         context.Context
@@ -164,6 +171,22 @@ func (rows *baseRows) Close() {
 		if rows.err == nil {
 			rows.err = closeErr
 		}
+		suspended := rows.portalName != "" && rows.resultReader.PortalSuspended()
+		if suspended {
+			// A portal that was not read to the end has no command tag. Report the rows that were read.
+			rows.commandTag = pgconn.NewCommandTag("SELECT " + strconv.Itoa(rows.rowCount))
+		} else if rows.portalRowCount > 0 {
+			rows.commandTag = addCommandTagRows(rows.commandTag, rows.portalRowCount)
+		}
+
+		// Close a portal that was not read to the end. A completely read portal is closed by the server at the end of the
+		// transaction.
+		if suspended && !rows.conn.pgConn.IsClosed() {
+			closeErr := rows.conn.pgConn.ClosePortal(rows.ctx, rows.portalName)
+			if rows.err == nil {
+				rows.err = closeErr
+			}
+		}
 	}
 
 	if rows.multiResultReader != nil {
@@ -218,12 +241,47 @@ func (rows *baseRows) Next() bool {
 		rows.rowCount++
 		rows.values = rows.resultReader.Values()
 		return true
+	} else if rows.fetchPortal() {
+		return rows.Next()
 	} else {
 		rows.Close()
 		return false
 	}
 }
 
+// fetchPortal fetches the next rows when the current rows were read from a portal that was suspended because the
+// fetch size was reached. It returns false if there are no more rows to fetch.
+func (rows *baseRows) fetchPortal() bool {
+	if rows.portalName == "" || !rows.resultReader.PortalSuspended() {
+		return false
+	}
+
+	_, err := rows.resultReader.Close()
+	if err != nil {
+		return false
+	}
+
+	// A suspended fetch has no command tag. All of its rows have been read.
+	rows.portalRowCount = int64(rows.rowCount)
+	rows.resultReader = rows.conn.pgConn.FetchPortal(rows.ctx, rows.portalName, rows.fetchSize)
+	return true
+}
+
+// addCommandTagRows adds n to the row count of commandTag. The server only reports the rows of the last Execute of a
+// portal so the rows of earlier fetches are added to it. A command tag without a row count is returned unchanged.
+func addCommandTagRows(commandTag pgconn.CommandTag, n int64) pgconn.CommandTag {
+	s := commandTag.String()
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	if i == len(s) {
+		return commandTag
+	}
+
+	return pgconn.NewCommandTag(s[:i] + strconv.FormatInt(commandTag.RowsAffected()+n, 10))
+}
+
 func (rows *baseRows) Scan(dest ...any) error {
 	m := rows.typeMap
 	fieldDescriptions := rows.FieldDescriptions()
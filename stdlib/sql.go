@@ -152,6 +152,9 @@ func OptionResetSession(rs func(context.Context, *pgx.Conn) error) OptionOpenDB
 // new host becomes primary each time. This is useful to distribute connections for multi-master databases like
 // CockroachDB. If you use this you likely should set https://golang.org/pkg/database/sql/#DB.SetConnMaxLifetime as well
 // to ensure that connections are periodically rebalanced across your nodes.
+//
+// The load_balance_hosts=random connection string setting provides similar behavior natively in pgconn and also
+// randomizes the order of the addresses each host resolves to.
 func RandomizeHostOrderFunc(ctx context.Context, connConfig *pgx.ConnConfig) error {
 	if len(connConfig.Fallbacks) == 0 {
 		return nil